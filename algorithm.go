@@ -0,0 +1,30 @@
+package htpasswd
+
+// An Algorithm names the hashing system of an encoded password.
+type Algorithm string
+
+// The algorithms of the builtin parsers.
+const (
+	AlgorithmUnknown     Algorithm = ""
+	AlgorithmPlain       Algorithm = "plain"
+	AlgorithmSha         Algorithm = "sha"
+	AlgorithmSsha        Algorithm = "ssha"
+	AlgorithmMd5Crypt    Algorithm = "md5-crypt"
+	AlgorithmApr1        Algorithm = "apr1"
+	AlgorithmBcrypt      Algorithm = "bcrypt"
+	AlgorithmCryptSha256 Algorithm = "crypt-sha256"
+	AlgorithmCryptSha512 Algorithm = "crypt-sha512"
+)
+
+// algorithmOf returns the algorithm of an encoded password, or AlgorithmUnknown if it is
+// neither one of the builtin ones nor a HashDescriber.
+func algorithmOf(ep EncodedPasswd) Algorithm {
+	switch a := ep.(type) {
+	case interface{ algorithm() Algorithm }:
+		return a.algorithm()
+	case HashDescriber:
+		info, _ := a.HashInfo()
+		return info.Algorithm
+	}
+	return AlgorithmUnknown
+}
@@ -0,0 +1,161 @@
+package htpasswd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrBadCredentials is returned by Authenticate if the username and password do not match.
+	// It is the more general form of ErrUnknownUser and ErrBadPassword, which both match it
+	// with errors.Is.
+	ErrBadCredentials = errors.New("bad credentials")
+	// ErrUnknownUser is returned by Authenticate if there is no such user.
+	ErrUnknownUser = fmt.Errorf("unknown user: %w", ErrBadCredentials)
+	// ErrBadPassword is returned by Authenticate if the password of a known user is wrong.
+	ErrBadPassword = fmt.Errorf("wrong password: %w", ErrBadCredentials)
+	// ErrDisabled is returned by Authenticate for a disabled account.
+	ErrDisabled = errors.New("account disabled")
+	// ErrExpired is returned by Authenticate for an expired account.
+	ErrExpired = errors.New("account expired")
+)
+
+// A Result describes the account that was checked by Authenticate.
+type Result struct {
+	// User is the record of the account. It is the zero User if the user is unknown.
+	User User
+	// Algorithm is the hashing system of the encoded password of the user.
+	Algorithm Algorithm
+}
+
+// Authenticate checks the username and password combination like Match, but tells why
+// the check failed: ErrUnknownUser, ErrBadPassword, ErrDisabled, ErrExpired or ErrLocked.
+// The account status is only reported if the password matches, so ErrDisabled and
+// ErrExpired do not reveal anything to someone guessing passwords. A locked account is
+// refused without checking the password.
+//
+// With WithMaxConcurrentChecks, it returns ErrBusy if too many checks are waiting. If the
+// user can't be looked up in a LookupStore, it returns an error matching ErrUnavailable.
+func (bf *Htpasswd) Authenticate(username, password string) (Result, error) {
+	return bf.AuthenticateContext(context.Background(), username, password)
+}
+
+// AuthenticateContext is like Authenticate, but gives up with the error of ctx once ctx is
+// done. See MatchContext.
+func (bf *Htpasswd) AuthenticateContext(ctx context.Context, username, password string) (Result, error) {
+	key, entry, ok, err := bf.lookup(ctx, username)
+	if err != nil {
+		return Result{}, err
+	}
+	if !ok {
+		if err := bf.checkDummy(ctx, password); err != nil {
+			return Result{}, err
+		}
+		return Result{}, ErrUnknownUser
+	}
+
+	result := Result{User: entry.user.clone(), Algorithm: algorithmOf(entry.matcher)}
+	if bf.lockout != nil && bf.lockout.status(key, bf.now()).Locked {
+		// with WithConstantTimeUnknownUsers a locked account must not answer faster than
+		// an unknown user, or failing a few times would tell whether the user exists
+		if err := bf.checkDummy(ctx, password); err != nil {
+			return result, err
+		}
+		return result, ErrLocked
+	}
+
+	if entry.matcher == nil {
+		if err := bf.checkDummy(ctx, password); err != nil {
+			return result, err
+		}
+		bf.failed(key)
+		return result, ErrBadPassword
+	}
+	matched, err := bf.matchesEntry(ctx, entry, password)
+	if err != nil {
+		return result, err
+	}
+	if !matched {
+		bf.failed(key)
+		return result, ErrBadPassword
+	}
+	if bf.lockout != nil {
+		bf.lockout.reset(key)
+	}
+
+	if entry.user.Disabled {
+		return result, ErrDisabled
+	}
+	if entry.user.Expired(bf.now()) {
+		return result, ErrExpired
+	}
+
+	bf.maybeRehash(key, entry, password)
+
+	return result, nil
+}
+
+// matchesEntry checks the password against the entry, using the cache and coalescing
+// concurrent checks if enabled.
+func (bf *Htpasswd) matchesEntry(ctx context.Context, entry *passwdEntry, password string) (bool, error) {
+	check := func() (bool, error) {
+		return bf.matches(ctx, entry.matcher, password)
+	}
+	if bf.hasher == nil {
+		return check()
+	}
+
+	key := bf.hasher.key(entry.user.Name, password, entry.encoded)
+	if bf.cache != nil && bf.cache.contains(key, bf.now()) {
+		return true, nil
+	}
+
+	var matched bool
+	var err error
+	if bf.flights != nil {
+		matched, err = bf.flights.do(ctx, key, check)
+	} else {
+		matched, err = check()
+	}
+	if matched && bf.cache != nil {
+		bf.cache.add(key, bf.now())
+	}
+	return matched, err
+}
+
+// matches checks the password against the encoded password, within the limit of
+// concurrent checks.
+func (bf *Htpasswd) matches(ctx context.Context, ep EncodedPasswd, password string) (bool, error) {
+	if bf.limiter != nil {
+		if err := bf.limiter.acquire(ctx); err != nil {
+			return false, err
+		}
+		defer bf.limiter.release()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if cep, ok := ep.(ContextEncodedPasswd); ok {
+		return cep.MatchesPasswordContext(ctx, password)
+	}
+	return ep.MatchesPassword(password), nil
+}
+
+// checkDummy checks the password against the dummy password, if any, to take as long as
+// checking the password of an existing user.
+func (bf *Htpasswd) checkDummy(ctx context.Context, password string) error {
+	if dummy := bf.dummy.Load(); dummy != nil && *dummy != nil {
+		_, err := bf.matches(ctx, *dummy, password)
+		return err
+	}
+	return nil
+}
+
+// failed records a failed attempt for the lockout.
+func (bf *Htpasswd) failed(key string) {
+	if bf.lockout != nil {
+		bf.lockout.fail(key, bf.now())
+	}
+}
@@ -0,0 +1,134 @@
+package htpasswd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var accountStatusContents = `alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+bob:!{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+carol:!
+dave:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=:2030-01-01
+`
+
+func TestAuthenticateAccountStatus(t *testing.T) {
+	now := time.Date(2029, 12, 31, 23, 59, 59, 0, time.UTC)
+	htp, err := NewFromReader(
+		strings.NewReader(accountStatusContents),
+		WithDisabledPrefix("!"),
+		WithUserFields(FieldExpires),
+		WithClock(func() time.Time { return now }),
+	)
+	assert.NoError(t, err)
+
+	result, err := htp.Authenticate("alice", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", result.User.Name)
+	assert.True(t, htp.Match("alice", "password"))
+
+	result, err = htp.Authenticate("alice", "wrong")
+	assert.ErrorIs(t, err, ErrBadPassword)
+	assert.ErrorIs(t, err, ErrBadCredentials)
+	assert.Equal(t, "alice", result.User.Name)
+	assert.Equal(t, AlgorithmSha, result.Algorithm)
+
+	result, err = htp.Authenticate("nobody", "password")
+	assert.ErrorIs(t, err, ErrUnknownUser)
+	assert.ErrorIs(t, err, ErrBadCredentials)
+	assert.NotErrorIs(t, err, ErrBadPassword)
+	assert.Equal(t, Result{}, result)
+
+	result, err = htp.Authenticate("bob", "password")
+	assert.ErrorIs(t, err, ErrDisabled)
+	assert.True(t, result.User.Disabled)
+	assert.False(t, htp.Match("bob", "password"))
+
+	// the status is only revealed with the right password
+	_, err = htp.Authenticate("bob", "wrong")
+	assert.ErrorIs(t, err, ErrBadPassword)
+
+	_, err = htp.Authenticate("carol", "")
+	assert.ErrorIs(t, err, ErrBadPassword)
+	carol, _ := htp.User("carol")
+	assert.True(t, carol.Disabled)
+
+	_, err = htp.Authenticate("dave", "password")
+	assert.NoError(t, err)
+
+	now = now.Add(time.Second)
+	_, err = htp.Authenticate("dave", "password")
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.False(t, htp.Match("dave", "password"))
+}
+
+func TestDisabledPrefixNotSet(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("bob:!secret\n"))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "!secret"))
+}
+
+func TestAuthenticateAlgorithm(t *testing.T) {
+	for contents, algorithm := range map[string]Algorithm{
+		textPlain:       AlgorithmPlain,
+		textSha:         AlgorithmSha,
+		textSsha:        AlgorithmSsha,
+		textApr1:        AlgorithmApr1,
+		textMd5Crypt:    AlgorithmMd5Crypt,
+		textBcrypt:      AlgorithmBcrypt,
+		testCryptSha256: AlgorithmCryptSha256,
+		testCryptSha512: AlgorithmCryptSha512,
+	} {
+		htp, err := NewFromReader(strings.NewReader(contents))
+		assert.NoError(t, err)
+
+		u := testUsers[0]
+		result, err := htp.Authenticate(u.username, u.password)
+		assert.NoError(t, err)
+		assert.Equal(t, algorithm, result.Algorithm)
+	}
+}
+
+// contextPassword is a plain text password which reports the context it was checked with.
+type contextPassword struct {
+	password string
+	ctx      context.Context
+}
+
+func (c *contextPassword) MatchesPassword(pw string) bool {
+	return constantTimeEquals(pw, c.password)
+}
+
+func (c *contextPassword) MatchesPasswordContext(ctx context.Context, pw string) (bool, error) {
+	c.ctx = ctx
+	return c.MatchesPassword(pw), nil
+}
+
+func TestAuthenticateContext(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.True(t, htp.MatchContext(ctx, "alice", "bar"))
+
+	cancel()
+	assert.False(t, htp.MatchContext(ctx, "alice", "bar"))
+	_, err = htp.AuthenticateContext(ctx, "alice", "bar")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the context is passed on to a ContextEncodedPasswd
+	var ep *contextPassword
+	htp, err = NewFromReader(strings.NewReader("alice:bar\n"), WithParsers(func(pw string) (EncodedPasswd, error) {
+		ep = &contextPassword{password: pw}
+		return ep, nil
+	}))
+	assert.NoError(t, err)
+
+	type ctxKey struct{}
+	ctx = context.WithValue(context.Background(), ctxKey{}, "value")
+	assert.True(t, htp.MatchContext(ctx, "alice", "bar"))
+	assert.Equal(t, "value", ep.ctx.Value(ctxKey{}))
+}
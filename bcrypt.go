@@ -22,6 +22,30 @@ func Bcrypt(src string) (EncodedPasswd, error) {
 	return &bcryptPassword{hashed: []byte(src)}, nil
 }
 
+// BcryptMinCost returns a PasswdParser which accepts passwords encoded using bcrypt with a
+// cost of at least minCost and rejects those with a lower cost. For example
+//
+//	htpasswd.New(filename, htpasswd.WithParsers(htpasswd.BcryptMinCost(12), htpasswd.RejectPlain))
+//
+// accepts only bcrypt with a cost of 12 or more.
+func BcryptMinCost(minCost int) PasswdParser {
+	return func(src string) (EncodedPasswd, error) {
+		ep, err := Bcrypt(src)
+		if ep == nil || err != nil {
+			return ep, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(src))
+		if err != nil {
+			return nil, fmt.Errorf("malformed bcrypt password: %s: %w", src, err)
+		}
+		if cost < minCost {
+			return nil, fmt.Errorf("bcrypt cost %d is below %d: %s", cost, minCost, src)
+		}
+		return ep, nil
+	}
+}
+
 // RejectBcrypt rejects any password encoded using bcrypt.
 func RejectBcrypt(src string) (EncodedPasswd, error) {
 	if strings.HasPrefix(src, "$2y$") || strings.HasPrefix(src, "$2a$") || strings.HasPrefix(
@@ -33,9 +57,33 @@ func RejectBcrypt(src string) (EncodedPasswd, error) {
 	return nil, nil
 }
 
+// BcryptEncoder returns a PasswdEncoder which encodes passwords using bcrypt with the given cost.
+func BcryptEncoder(cost int) PasswdEncoder {
+	return func(pw string) (string, error) {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(pw), cost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	}
+}
+
 func (b *bcryptPassword) MatchesPassword(password string) bool {
 	if err := bcrypt.CompareHashAndPassword(b.hashed, []byte(password)); err != nil {
 		return false
 	}
 	return true
 }
+
+func (b *bcryptPassword) algorithm() Algorithm {
+	return AlgorithmBcrypt
+}
+
+func (b *bcryptPassword) hashInfo() (HashInfo, error) {
+	cost, err := bcrypt.Cost(b.hashed)
+	if err != nil {
+		return HashInfo{}, fmt.Errorf("malformed bcrypt password: %s: %w", b.hashed, err)
+	}
+	// the 22 characters after "$2y$10$" encode the 16 bytes of the salt
+	return HashInfo{Variant: string(b.hashed[:4]), Cost: cost, SaltLength: 16}, nil
+}
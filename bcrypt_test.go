@@ -17,3 +17,20 @@ func Test_Bcrypt(t *testing.T) {
 	testParserBad(t, "bcrypt", nil, RejectBcrypt, "$2y$0")
 	testParserNot(t, "bcrypt", nil, RejectBcrypt, "plaintext")
 }
+
+func Test_BcryptEncoder(t *testing.T) {
+	encoded, err := BcryptEncoder(5)("bar")
+	if err != nil {
+		t.Fatalf("bcrypt encoder failed: %s", err.Error())
+	}
+	testParserGood(t, "bcrypt", Bcrypt, RejectBcrypt, encoded, "bar")
+}
+
+func Test_BcryptMinCost(t *testing.T) {
+	testParserGood(
+		t, "bcrypt", BcryptMinCost(8), nil, "$2b$08$hQbZuw.cHsECArUAP9mOjehaJxTG9NMJfioQIHcbC0YyXpVybhoQa", "bar",
+	)
+	testParserBad(t, "bcrypt", BcryptMinCost(8), nil, "$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O")
+	testParserBad(t, "bcrypt", BcryptMinCost(8), nil, "$2y$0")
+	testParserNot(t, "bcrypt", BcryptMinCost(8), nil, "plaintext")
+}
@@ -0,0 +1,112 @@
+package htpasswd
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// WithCache remembers successful password checks for ttl, so a client sending the same
+// credentials with every request doesn't cost a bcrypt computation each time. At most size
+// checks are remembered, the least recently used are dropped first.
+//
+// The cache doesn't keep the passwords. It keeps an HMAC of the username, password and
+// encoded password, with a random key made up for each Htpasswd. As the encoded password is
+// part of it, a cached check is not used anymore once Reload changed the password of a user.
+func WithCache(ttl time.Duration, size int) Option {
+	return func(p *parameters) {
+		p.cache = newVerifyCache(ttl, size)
+	}
+}
+
+type cacheKey [sha256.Size]byte
+
+type cacheEntry struct {
+	key     cacheKey
+	expires time.Time
+}
+
+// verifyCache is an LRU cache of successful password checks.
+type verifyCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+}
+
+func newVerifyCache(ttl time.Duration, size int) *verifyCache {
+	return &verifyCache{
+		ttl:     ttl,
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// credentialHasher identifies credentials without keeping the password.
+type credentialHasher struct {
+	secret []byte
+}
+
+func newCredentialHasher() *credentialHasher {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return &credentialHasher{secret}
+}
+
+// key returns the HMAC of the credentials and the encoded password they were checked against.
+func (h *credentialHasher) key(username, password, encoded string) cacheKey {
+	mac := hmac.New(sha256.New, h.secret)
+	for _, s := range []string{username, password, encoded} {
+		// length prefixed, so the parts can't be shifted against each other
+		n := len(s)
+		mac.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+		mac.Write([]byte(s))
+	}
+
+	var key cacheKey
+	mac.Sum(key[:0])
+	return key
+}
+
+// contains reports whether a successful check of key is cached and not yet expired.
+func (c *verifyCache) contains(key cacheKey, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if !now.Before(elem.Value.(*cacheEntry).expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return false
+	}
+	c.lru.MoveToFront(elem)
+	return true
+}
+
+// add caches a successful check of key.
+func (c *verifyCache) add(key cacheKey, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).expires = now.Add(c.ttl)
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, expires: now.Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,86 @@
+package htpasswd
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingPassword is a plain text password which counts the checks.
+type countingPassword struct {
+	password string
+	checks   *atomic.Int32
+}
+
+func (c *countingPassword) MatchesPassword(pw string) bool {
+	c.checks.Add(1)
+	return constantTimeEquals(pw, c.password)
+}
+
+func countingParser(checks *atomic.Int32) PasswdParser {
+	return func(pw string) (EncodedPasswd, error) {
+		return &countingPassword{pw, checks}, nil
+	}
+}
+
+func TestCache(t *testing.T) {
+	var checks atomic.Int32
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	htp, err := NewFromReader(
+		strings.NewReader("alice:bar\nbob:baz\n"),
+		WithParsers(countingParser(&checks)),
+		WithCache(time.Minute, 2),
+		WithClock(func() time.Time { return now }),
+	)
+	assert.NoError(t, err)
+
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.Equal(t, int32(1), checks.Load())
+
+	// failures are not cached
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.Equal(t, int32(3), checks.Load())
+
+	// expired
+	now = now.Add(time.Minute)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.Equal(t, int32(4), checks.Load())
+
+	// a changed password is not matched from the cache
+	assert.NoError(t, htp.ReloadFromReader(strings.NewReader("alice:new\nbob:baz\n")))
+	assert.False(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("alice", "new"))
+	assert.Equal(t, int32(6), checks.Load())
+
+	// a removed user is not matched from the cache
+	assert.NoError(t, htp.ReloadFromReader(strings.NewReader("bob:baz\n")))
+	assert.False(t, htp.Match("alice", "new"))
+	assert.Equal(t, int32(6), checks.Load())
+}
+
+func TestVerifyCacheSize(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newVerifyCache(time.Minute, 2)
+	h := newCredentialHasher()
+
+	a, b, d := h.key("a", "pw", "pw"), h.key("b", "pw", "pw"), h.key("d", "pw", "pw")
+	assert.NotEqual(t, a, b)
+	assert.NotEqual(t, h.key("ab", "c", ""), h.key("a", "bc", ""))
+
+	c.add(a, now)
+	c.add(b, now)
+	assert.True(t, c.contains(a, now))
+	c.add(d, now)
+	assert.True(t, c.contains(a, now))
+	assert.False(t, c.contains(b, now))
+	assert.True(t, c.contains(d, now))
+	assert.Equal(t, 2, c.lru.Len())
+
+	// keys depend on the secret
+	assert.NotEqual(t, a, newCredentialHasher().key("a", "pw", "pw"))
+}
@@ -0,0 +1,308 @@
+// Command htpasswd exports the users of an htpasswd file and group file as JSON, YAML, CSV
+// or LDIF, and imports them back into htpasswd and group files.
+//
+//	htpasswd export -htpasswd .htpasswd -groups .htgroups -format yaml > users.yaml
+//	htpasswd import -format yaml -in users.yaml -htpasswd .htpasswd -groups .htgroups
+//	htpasswd ldif -htpasswd .htpasswd -groups .htgroups -base-dn dc=example,dc=com > users.ldif
+//
+// The files may be encrypted with the key given by -key, and signed with the private key
+// of the public key given by -public-key. Both are files with the key in base64. Imported
+// files are written encrypted with -key; signed files can't be written.
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peick/go-htpasswd"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s export|import|ldif [flags]\n", os.Args[0])
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "import":
+		err = importUsers(os.Args[2:])
+	case "ldif":
+		err = exportLDIF(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// fileFlags are the flags describing the htpasswd and group files.
+type fileFlags struct {
+	htpasswd       string
+	groups         string
+	fields         string
+	disabledPrefix string
+	key            string
+	publicKey      string
+}
+
+func (f *fileFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.htpasswd, "htpasswd", "", "htpasswd `file`")
+	fs.StringVar(&f.groups, "groups", "", "group `file`, optional")
+	fs.StringVar(&f.fields, "fields", "", "comma separated `layout` of the user fields: comment, displayname, email, expires, flags or ignore")
+	fs.StringVar(&f.disabledPrefix, "disabled-prefix", "", "`prefix` of the encoded password of disabled accounts")
+	fs.StringVar(&f.key, "key", "", "`file` with the base64 AES key the files are encrypted with")
+	fs.StringVar(&f.publicKey, "public-key", "", "`file` with the base64 ed25519 public key the files are signed with")
+}
+
+// keys reads the encryption key and the public key, which are nil if not given.
+func (f *fileFlags) keys() ([]byte, ed25519.PublicKey, error) {
+	var key, publicKey []byte
+	var err error
+	if f.key != "" {
+		if key, err = readKey(f.key); err != nil {
+			return nil, nil, err
+		}
+	}
+	if f.publicKey != "" {
+		if publicKey, err = readKey(f.publicKey); err != nil {
+			return nil, nil, err
+		}
+		if len(publicKey) != ed25519.PublicKeySize {
+			return nil, nil, fmt.Errorf("public key %s: not an ed25519 public key", f.publicKey)
+		}
+	}
+	return key, publicKey, nil
+}
+
+// groupOptions returns the options of the group file.
+func (f *fileFlags) groupOptions() ([]htpasswd.GroupOption, error) {
+	key, publicKey, err := f.keys()
+	if err != nil {
+		return nil, err
+	}
+	var opts []htpasswd.GroupOption
+	if key != nil {
+		opts = append(opts, htpasswd.WithGroupEncryptionKey(key))
+	}
+	if publicKey != nil {
+		opts = append(opts, htpasswd.WithGroupPublicKey(publicKey))
+	}
+	return opts, nil
+}
+
+// readKey reads a base64 encoded key from a file.
+func readKey(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func (f *fileFlags) options() ([]htpasswd.Option, error) {
+	var opts []htpasswd.Option
+	if f.fields != "" {
+		var layout []htpasswd.UserField
+		for _, name := range strings.Split(f.fields, ",") {
+			field, ok := map[string]htpasswd.UserField{
+				"ignore":      htpasswd.FieldIgnore,
+				"comment":     htpasswd.FieldComment,
+				"displayname": htpasswd.FieldDisplayName,
+				"email":       htpasswd.FieldEmail,
+				"expires":     htpasswd.FieldExpires,
+				"flags":       htpasswd.FieldFlags,
+			}[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown user field %s", name)
+			}
+			layout = append(layout, field)
+		}
+		opts = append(opts, htpasswd.WithUserFields(layout...))
+	}
+	if f.disabledPrefix != "" {
+		opts = append(opts, htpasswd.WithDisabledPrefix(f.disabledPrefix))
+	}
+	key, publicKey, err := f.keys()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		opts = append(opts, htpasswd.WithEncryptionKey(key))
+	}
+	if publicKey != nil {
+		opts = append(opts, htpasswd.WithPublicKey(publicKey))
+	}
+	return opts, nil
+}
+
+// load reads the htpasswd and group files.
+func (f *fileFlags) load() (*htpasswd.Htpasswd, *htpasswd.HTGroup, error) {
+	if f.htpasswd == "" {
+		return nil, nil, fmt.Errorf("missing -htpasswd")
+	}
+	opts, err := f.options()
+	if err != nil {
+		return nil, nil, err
+	}
+	users, err := htpasswd.New(f.htpasswd, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var groups *htpasswd.HTGroup
+	if f.groups != "" {
+		groupOpts, err := f.groupOptions()
+		if err != nil {
+			return nil, nil, err
+		}
+		if groups, err = htpasswd.NewHTGroup(f.groups, groupOpts...); err != nil {
+			return nil, nil, err
+		}
+	}
+	return users, groups, nil
+}
+
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var files fileFlags
+	files.register(fs)
+	format := fs.String("format", "json", "output `format`: json, yaml or csv")
+	fs.Parse(args)
+
+	users, groups, err := files.load()
+	if err != nil {
+		return err
+	}
+	return htpasswd.EncodeUsers(os.Stdout, htpasswd.Format(*format), htpasswd.Export(users, groups))
+}
+
+func exportLDIF(args []string) error {
+	fs := flag.NewFlagSet("ldif", flag.ExitOnError)
+	var files fileFlags
+	files.register(fs)
+	var opts htpasswd.LDIFOptions
+	fs.StringVar(&opts.BaseDN, "base-dn", "", "base `DN` of the users and groups")
+	fs.StringVar(&opts.UsersRDN, "users-rdn", "", "container of the users below the base DN, ou=people if empty")
+	fs.StringVar(&opts.GroupsRDN, "groups-rdn", "", "container of the groups below the base DN, ou=groups if empty")
+	fs.Parse(args)
+
+	if opts.BaseDN == "" {
+		return fmt.Errorf("missing -base-dn")
+	}
+	users, groups, err := files.load()
+	if err != nil {
+		return err
+	}
+	unrepresentable, err := htpasswd.ExportLDIF(os.Stdout, users, groups, opts)
+	for _, u := range unrepresentable {
+		fmt.Fprintf(os.Stderr, "password of %s can't be exported: %s is not supported by LDAP\n", u.Username, u.Algorithm)
+	}
+	return err
+}
+
+func importUsers(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var files fileFlags
+	files.register(fs)
+	format := fs.String("format", "json", "input `format`: json, yaml or csv")
+	in := fs.String("in", "", "input `file`, standard input if empty")
+	fs.Parse(args)
+
+	if files.htpasswd == "" {
+		return fmt.Errorf("missing -htpasswd")
+	}
+	if files.publicKey != "" {
+		return fmt.Errorf("signed files can't be written, sign them after the import")
+	}
+	opts, err := files.options()
+	if err != nil {
+		return err
+	}
+	groupOpts, err := files.groupOptions()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	users, err := htpasswd.DecodeUsers(r, htpasswd.Format(*format))
+	if err != nil {
+		return err
+	}
+
+	// both files are validated before anything is written
+	var htpasswdContent, groupContent bytes.Buffer
+	if err := htpasswd.WriteHtpasswd(&htpasswdContent, users, opts...); err != nil {
+		return err
+	}
+	if err := htpasswd.WriteGroups(&groupContent, users, groupOpts...); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(files.htpasswd, htpasswdContent.Bytes()); err != nil {
+		return err
+	}
+	if files.groups != "" {
+		return writeFileAtomic(files.groups, groupContent.Bytes())
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path by content, so that a server reloading it never
+// reads a partly written file. An existing file keeps its permissions, a new one gets 0640.
+func writeFileAtomic(path string, content []byte) error {
+	perm := os.FileMode(0o640)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
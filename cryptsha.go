@@ -2,6 +2,7 @@ package htpasswd
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/GehirnInc/crypt"
@@ -52,6 +53,27 @@ func CryptSha(src string) (EncodedPasswd, error) {
 	return &cryptPassword{prefix, rounds, salt, hashed}, nil
 }
 
+// CryptShaMinRounds returns a PasswdParser which accepts passwords encoded using crypt-sha
+// with at least minRounds rounds and rejects those with fewer rounds. A password without
+// the rounds component has DefaultCryptShaRounds.
+func CryptShaMinRounds(minRounds int) PasswdParser {
+	return func(src string) (EncodedPasswd, error) {
+		ep, err := CryptSha(src)
+		if ep == nil || err != nil {
+			return ep, err
+		}
+
+		rounds, err := parseRounds(ep.(*cryptPassword).rounds)
+		if err != nil {
+			return nil, fmt.Errorf("malformed crypt-SHA password: %s: %w", src, err)
+		}
+		if rounds < minRounds {
+			return nil, fmt.Errorf("crypt-sha rounds %d are below %d: %s", rounds, minRounds, src)
+		}
+		return ep, nil
+	}
+}
+
 // PK04832_45b047bab2bf:$6$rounds=5000$e4fb4910470fd97e$afWSvXIlcC4KnENaYStPG/ELJ.uBAnG7r/rFz8fkNwpkU.salSCchDjtxyh.qA.fftcd5hmIcem7A4oA76HCE0
 
 // RejectCryptSha known indexes
@@ -62,6 +84,46 @@ func RejectCryptSha(src string) (EncodedPasswd, error) {
 	return nil, fmt.Errorf("crypt-sha password rejected: %s", src)
 }
 
+// CryptSha256Encoder returns a PasswdEncoder which encodes passwords using crypt-sha256 with
+// the given number of rounds. If rounds is 0 the rounds component is left out, which means
+// DefaultCryptShaRounds.
+func CryptSha256Encoder(rounds int) PasswdEncoder {
+	return cryptShaEncoder(PrefixCryptSha256, rounds)
+}
+
+// CryptSha512Encoder returns a PasswdEncoder which encodes passwords using crypt-sha512 with
+// the given number of rounds. If rounds is 0 the rounds component is left out, which means
+// DefaultCryptShaRounds.
+func CryptSha512Encoder(rounds int) PasswdEncoder {
+	return cryptShaEncoder(PrefixCryptSha512, rounds)
+}
+
+func cryptShaEncoder(prefix string, rounds int) PasswdEncoder {
+	var roundsComponent string
+	if rounds > 0 {
+		roundsComponent = fmt.Sprintf("rounds=%d", rounds)
+	}
+
+	return func(pw string) (string, error) {
+		salt := randomSalt(16)
+		hashed, err := shaCrypt(pw, roundsComponent, salt, prefix)
+		if err != nil {
+			return "", err
+		}
+
+		var sb strings.Builder
+		sb.WriteString(prefix)
+		if roundsComponent != "" {
+			sb.WriteString(roundsComponent)
+			sb.WriteString(Separator)
+		}
+		sb.WriteString(salt)
+		sb.WriteString(Separator)
+		sb.WriteString(hashed)
+		return sb.String(), nil
+	}
+}
+
 func shaCrypt(password string, rounds string, salt string, prefix string) (string, error) {
 	var ret string
 	var sb strings.Builder
@@ -100,3 +162,41 @@ func (m *cryptPassword) MatchesPassword(pw string) bool {
 	}
 	return constantTimeEquals(hashed, m.hashed)
 }
+
+func (m *cryptPassword) algorithm() Algorithm {
+	if m.prefix == PrefixCryptSha256 {
+		return AlgorithmCryptSha256
+	}
+	return AlgorithmCryptSha512
+}
+
+func (m *cryptPassword) hashInfo() (HashInfo, error) {
+	rounds, err := parseRounds(m.rounds)
+	if err != nil {
+		return HashInfo{}, fmt.Errorf("malformed crypt-SHA password: %s: %w", m.prefix+m.rounds, err)
+	}
+	return HashInfo{Variant: m.prefix, Rounds: rounds, SaltLength: len(m.salt)}, nil
+}
+
+// DefaultCryptShaRounds is the number of rounds of crypt-sha if the rounds component is absent.
+const DefaultCryptShaRounds = 5000
+
+// roundCount returns the number of rounds, taking the implicit default into account.
+func (m *cryptPassword) roundCount() int {
+	n, err := parseRounds(m.rounds)
+	if err != nil {
+		return DefaultCryptShaRounds
+	}
+	return n
+}
+
+// parseRounds parses the rounds component like "rounds=5000".
+func parseRounds(rounds string) (int, error) {
+	if rounds == "" {
+		return DefaultCryptShaRounds, nil
+	}
+	if !strings.HasPrefix(rounds, "rounds=") {
+		return 0, fmt.Errorf("invalid rounds component: %s", rounds)
+	}
+	return strconv.Atoi(strings.TrimPrefix(rounds, "rounds="))
+}
@@ -2,6 +2,7 @@ package htpasswd
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -55,3 +56,31 @@ func Test_CryptSha(t *testing.T) {
 	testParserNot(t, "crypt-sha512", CryptSha, RejectCryptSha, "plain")
 	testParserNot(t, "crypt-sha512", CryptSha, RejectCryptSha, "{SHA}plain")
 }
+
+func Test_CryptShaEncoder(t *testing.T) {
+	for _, encode := range []PasswdEncoder{CryptSha256Encoder(0), CryptSha512Encoder(0), CryptSha512Encoder(6000)} {
+		encoded, err := encode("mickey")
+		if err != nil {
+			t.Fatalf("crypt-sha encoder failed: %s", err.Error())
+		}
+		testParserGood(t, "crypt-sha", CryptSha, RejectCryptSha, encoded, "mickey")
+	}
+
+	encoded, _ := CryptSha512Encoder(6000)("mickey")
+	if !strings.HasPrefix(encoded, "$6$rounds=6000$") {
+		t.Errorf("crypt-sha512 encoder ignored the rounds: %s", encoded)
+	}
+}
+
+func Test_CryptShaMinRounds(t *testing.T) {
+	implicit := "$6$98765432101234567890$FPU3HtJ9RcPVUvxifkIJ/AlrBxWLqJQvyxK2f8x4qDX/A1RpcIvgjToU5erVkR6XUl7qwPsm7idpbMH5f/pBn0"
+	explicit := "$6$rounds=5000$98765432101234567890$FPU3HtJ9RcPVUvxifkIJ/AlrBxWLqJQvyxK2f8x4qDX/A1RpcIvgjToU5erVkR6XUl7qwPsm7idpbMH5f/pBn0"
+
+	testParserGood(t, "crypt-sha512", CryptShaMinRounds(5000), nil, implicit, "dreadpirateroberts")
+	testParserGood(t, "crypt-sha512", CryptShaMinRounds(5000), nil, explicit, "dreadpirateroberts")
+	testParserBad(t, "crypt-sha512", CryptShaMinRounds(5001), nil, implicit)
+	testParserBad(t, "crypt-sha512", CryptShaMinRounds(5001), nil, explicit)
+	testParserBad(t, "crypt-sha512", CryptShaMinRounds(5000), nil, "$6$rounds=many$salt$hash")
+	testParserBad(t, "crypt-sha512", CryptShaMinRounds(5000), nil, "$6$nosalt")
+	testParserNot(t, "crypt-sha512", CryptShaMinRounds(5000), nil, "{SHA}plain")
+}
@@ -0,0 +1,116 @@
+package htpasswd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// encryptedHeader starts the content of an encrypted htpasswd or group file. It is followed
+// by the base64 encoded nonce and AES-GCM sealed content.
+const encryptedHeader = "#htpasswd-encrypted:aes-gcm:v1\n"
+
+// ErrNotEncrypted is returned when a key is given but a file is not encrypted.
+var ErrNotEncrypted = errors.New("not encrypted")
+
+// WithEncryptionKey decrypts the htpasswd file read by New, NewFromFS, NewFromGlob or
+// NewFromReader with key, an AES key of 16, 24 or 32 bytes. Files encrypted by Encrypt can
+// be committed to a config repository, and are decrypted only in the running service.
+// Unencrypted files are refused. With WithRehash, the file is written encrypted again.
+//
+// Stores given to NewFromStore have their own key, see FileStore; NewFromStore, NewFromEnv
+// and NewFromSecretDir refuse this option.
+func WithEncryptionKey(key []byte) Option {
+	return func(p *parameters) {
+		p.key = key
+	}
+}
+
+// Encrypt encrypts the content of an htpasswd or group file with key, an AES key of 16, 24
+// or 32 bytes. The result is text, a header line followed by the encrypted content in
+// base64.
+func Encrypt(key, content []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(content)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, content, []byte(encryptedHeader))
+
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+	var buf bytes.Buffer
+	buf.WriteString(encryptedHeader)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\n")
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt with key. It returns ErrNotEncrypted if data
+// was not encrypted.
+func Decrypt(key, data []byte) ([]byte, error) {
+	body, ok := bytes.CutPrefix(data, []byte(encryptedHeader))
+	if !ok {
+		return nil, ErrNotEncrypted
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(body), nil)))
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted content: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted content: too short")
+	}
+	content, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(encryptedHeader))
+	if err != nil {
+		return nil, errors.New("failed to decrypt: wrong key or tampered content")
+	}
+	return content, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptContent decrypts the content of the file name with key, unless key is nil.
+// Encrypted content is refused without a key, as it would be parsed as garbage.
+func decryptContent(content, key []byte, name string) ([]byte, error) {
+	if key == nil {
+		if bytes.HasPrefix(content, []byte(encryptedHeader)) {
+			return nil, withSource(name, errors.New("encrypted, but there is no key"))
+		}
+		return content, nil
+	}
+
+	decrypted, err := Decrypt(key, content)
+	if err != nil {
+		return nil, withSource(name, err)
+	}
+	return decrypted, nil
+}
+
+// encryptContent is the counterpart of decryptContent.
+func encryptContent(content, key []byte) ([]byte, error) {
+	if key == nil {
+		return content, nil
+	}
+	return Encrypt(key, content)
+}
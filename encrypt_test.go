@@ -0,0 +1,123 @@
+package htpasswd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestEncryptDecrypt(t *testing.T) {
+	content := []byte(textBcrypt)
+	encrypted, err := Encrypt(testKey, content)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(encrypted), encryptedHeader))
+	assert.NotContains(t, string(encrypted), "user1")
+
+	decrypted, err := Decrypt(testKey, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, content, decrypted)
+
+	// every encryption is different
+	again, err := Encrypt(testKey, content)
+	assert.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+
+	_, err = Decrypt([]byte("fedcba9876543210fedcba9876543210"), encrypted)
+	assert.EqualError(t, err, "failed to decrypt: wrong key or tampered content")
+
+	tampered := bytes.Clone(encrypted)
+	i := len(encryptedHeader) + 20
+	tampered[i] ^= 'A' ^ 'B'
+	_, err = Decrypt(testKey, tampered)
+	assert.Error(t, err)
+
+	_, err = Decrypt(testKey, content)
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	_, err = Encrypt([]byte("short"), content)
+	assert.Error(t, err)
+}
+
+func TestEncryptedFiles(t *testing.T) {
+	encrypted, err := Encrypt(testKey, []byte("bob:bar\n"))
+	assert.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, os.WriteFile(filename, encrypted, 0o640))
+
+	htp, err := New(filename, WithEncryptionKey(testKey))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+
+	htp, err = NewFromFS(fstest.MapFS{"htpasswd": {Data: encrypted}}, "htpasswd", WithEncryptionKey(testKey))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+
+	htp, err = NewFromReader(bytes.NewReader(encrypted), WithEncryptionKey(testKey))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+
+	// encrypted files are refused without a key, unencrypted ones with a key
+	_, err = New(filename)
+	assert.EqualError(t, err, filename+": encrypted, but there is no key")
+	_, err = NewFromReader(strings.NewReader("bob:bar\n"), WithEncryptionKey(testKey))
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+}
+
+func TestEncryptedRehash(t *testing.T) {
+	encrypted, err := Encrypt(testKey, []byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=:Bob\n"))
+	assert.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, os.WriteFile(filename, encrypted, 0o640))
+
+	var rehashErr error
+	htp, err := New(filename, WithEncryptionKey(testKey), WithUserFields(FieldDisplayName), WithRehash(
+		RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}},
+		BcryptEncoder(4),
+		func(_ string, err error) { rehashErr = err },
+	))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "password"))
+	assert.NoError(t, rehashErr)
+
+	// the file is still encrypted
+	written, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	content, err := Decrypt(testKey, written)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "bob:$2a$04$"))
+	assert.True(t, strings.HasSuffix(string(content), ":Bob\n"))
+
+	assert.NoError(t, htp.Reload())
+	assert.True(t, htp.Match("bob", "password"))
+}
+
+func TestEncryptedGroups(t *testing.T) {
+	encrypted, err := Encrypt(testKey, []byte(contents))
+	assert.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "groups")
+	assert.NoError(t, os.WriteFile(filename, encrypted, 0o640))
+
+	htGroup, err := NewHTGroup(filename, WithGroupEncryptionKey(testKey))
+	assert.NoError(t, err)
+	assert.True(t, htGroup.IsUserInGroup("user1", "admins"))
+
+	htGroup, err = NewHTGroupFromFS(fstest.MapFS{"groups": {Data: encrypted}}, "groups", WithGroupEncryptionKey(testKey))
+	assert.NoError(t, err)
+	assert.True(t, htGroup.IsUserInGroup("user1", "admins"))
+
+	htGroup, err = NewHTGroupsFromReader(bytes.NewReader(encrypted), WithGroupEncryptionKey(testKey))
+	assert.NoError(t, err)
+	assert.True(t, htGroup.IsUserInGroup("user1", "admins"))
+
+	_, err = NewHTGroup(filename)
+	assert.EqualError(t, err, filename+": encrypted, but there is no key")
+	_, err = NewHTGroupsFromReader(strings.NewReader(contents), WithGroupEncryptionKey(testKey))
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+}
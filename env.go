@@ -0,0 +1,99 @@
+package htpasswd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An EnvStore is a Store with the users in environment variables, one per user. The name of
+// a variable is the prefix followed by the username, the value is the encoded password, e.g.
+// HTPASSWD_USER_alice=$2y$05$...
+type EnvStore struct {
+	// Prefix must not be empty, otherwise every environment variable would be a user.
+	Prefix string
+	// Environ returns the environment as "key=value" strings, nil for os.Environ.
+	Environ func() []string
+}
+
+// Load implements Store. The source of the entries is the name of the variable.
+func (s *EnvStore) Load(ctx context.Context) ([]Entry, string, error) {
+	if s.Prefix == "" {
+		return nil, "", errors.New("empty prefix of environment variables")
+	}
+	environ := s.Environ
+	if environ == nil {
+		environ = os.Environ
+	}
+
+	var entries []Entry
+	for _, kv := range environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		username, ok := strings.CutPrefix(name, s.Prefix)
+		if !ok || username == "" {
+			continue
+		}
+		entries = append(entries, Entry{Username: username, Value: value, Source: "environment variable " + name})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Username < entries[j].Username })
+
+	return entries, entriesVersion(entries), nil
+}
+
+// A SecretDirStore is a Store with the users in a directory with one file per user, as
+// secrets are mounted e.g. by Kubernetes. The file name is the username, the content is the
+// encoded password; surrounding white space is ignored. Hidden files and directories are
+// skipped.
+type SecretDirStore struct {
+	Dir string
+}
+
+// Load implements Store. The source of the entries is the file name.
+func (s *SecretDirStore) Load(ctx context.Context) ([]Entry, string, error) {
+	dirEntries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open secret directory %s: %w", s.Dir, err)
+	}
+
+	var entries []Entry
+	for _, dirEntry := range dirEntries {
+		username := dirEntry.Name()
+		if strings.HasPrefix(username, ".") {
+			continue
+		}
+
+		// secrets are usually symlinks, so the type of the target matters
+		path := filepath.Join(s.Dir, username)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open secret %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open secret %s: %w", path, err)
+		}
+		entries = append(entries, Entry{Username: username, Value: strings.TrimSpace(string(content)), Source: path})
+	}
+
+	return entries, entriesVersion(entries), nil
+}
+
+// NewFromEnv is like New but reads the users from the environment variables starting with
+// prefix, see EnvStore.
+func NewFromEnv(prefix string, opts ...Option) (*Htpasswd, error) {
+	return NewFromStore(&EnvStore{Prefix: prefix}, opts...)
+}
+
+// NewFromSecretDir is like New but reads the users from a directory with one file per user,
+// see SecretDirStore.
+func NewFromSecretDir(dir string, opts ...Option) (*Htpasswd, error) {
+	return NewFromStore(&SecretDirStore{Dir: dir}, opts...)
+}
@@ -0,0 +1,72 @@
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvStore(t *testing.T) {
+	environ := []string{
+		"HOME=/root",
+		"HTPASSWD_USER_alice=bar",
+		"HTPASSWD_USER_bob={SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		"HTPASSWD_USER_=bar",
+		"HTPASSWD_USERS=carol",
+	}
+	htp, err := NewFromStore(&EnvStore{Prefix: "HTPASSWD_USER_", Environ: func() []string { return environ }})
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("bob", "password"))
+	assert.Equal(t, []string{"alice", "bob"}, usernames(htp))
+
+	environ = append(environ, "HTPASSWD_USER_carol={SHA}broken")
+	assert.ErrorContains(t, htp.Reload(), "environment variable HTPASSWD_USER_carol: ")
+
+	t.Setenv("TEST_HTPASSWD_dave", "bar")
+	htp, err = NewFromEnv("TEST_HTPASSWD_")
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("dave", "bar"))
+
+	// without prefix, every variable would be a user
+	_, err = NewFromEnv("")
+	assert.EqualError(t, err, "empty prefix of environment variables")
+}
+
+func TestSecretDirStore(t *testing.T) {
+	// the layout of a secret mounted by Kubernetes
+	dir := t.TempDir()
+	data := filepath.Join(dir, "..2024_01_01_00_00_00.000000000")
+	assert.NoError(t, os.Mkdir(data, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(data, "alice"), []byte("bar\n"), 0o640))
+	assert.NoError(t, os.WriteFile(filepath.Join(data, "bob"), []byte("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="), 0o640))
+	assert.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink("..data/alice", filepath.Join(dir, "alice")))
+	assert.NoError(t, os.Symlink("..data/bob", filepath.Join(dir, "bob")))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o755))
+
+	htp, err := NewFromSecretDir(dir)
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("bob", "password"))
+	assert.Equal(t, []string{"alice", "bob"}, usernames(htp))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "carol"), []byte("{SHA}broken"), 0o640))
+	assert.ErrorContains(t, htp.Reload(), filepath.Join(dir, "carol")+": ")
+
+	_, err = NewFromSecretDir(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+// usernames returns the sorted names of the users.
+func usernames(htp *Htpasswd) []string {
+	var names []string
+	for _, entry := range *htp.passwds.Load() {
+		names = append(names, entry.user.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,320 @@
+package htpasswd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// An ExportedUser is a user as exported by Export, with the encoded password and the group
+// memberships.
+type ExportedUser struct {
+	Username string `json:"username" yaml:"username"`
+	// Password is the encoded password. It is empty for a disabled account without password.
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	// Algorithm is the hashing system of the password. It is informative only, but checked
+	// against the password on import if set.
+	Algorithm   Algorithm  `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Disabled    bool       `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Comment     string     `json:"comment,omitempty" yaml:"comment,omitempty"`
+	DisplayName string     `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	Email       string     `json:"email,omitempty" yaml:"email,omitempty"`
+	Expires     *time.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Flags       []string   `json:"flags,omitempty" yaml:"flags,omitempty"`
+	Groups      []string   `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// A Format is a file format for exported users.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	// FormatCSV has a header line and a column per field of ExportedUser. Flags and groups
+	// are separated by spaces.
+	FormatCSV Format = "csv"
+)
+
+var csvHeader = []string{
+	"username", "password", "algorithm", "disabled", "comment", "display_name", "email",
+	"expires", "flags", "groups",
+}
+
+// Export returns the users of htp, sorted by username, with their groups in groups, which
+// may be nil.
+func Export(htp *Htpasswd, groups *HTGroup) []ExportedUser {
+	table := *htp.passwds.Load()
+	users := make([]ExportedUser, 0, len(table))
+	for _, entry := range table {
+		user := ExportedUser{
+			Username:    entry.user.Name,
+			Password:    entry.encoded,
+			Algorithm:   algorithmOf(entry.matcher),
+			Disabled:    entry.user.Disabled,
+			Comment:     entry.user.Comment,
+			DisplayName: entry.user.DisplayName,
+			Email:       entry.user.Email,
+			Flags:       slices.Clone(entry.user.Flags),
+		}
+		if !entry.user.Expires.IsZero() {
+			expires := entry.user.Expires
+			user.Expires = &expires
+		}
+		if groups != nil {
+			if memberships := groups.GetUserGroups(entry.user.Name); len(memberships) > 0 {
+				user.Groups = slices.Clone(memberships)
+			}
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+// EncodeUsers writes the users to w in the format.
+func EncodeUsers(w io.Writer, format Format, users []ExportedUser) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(users)
+	case FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(users); err != nil {
+			return err
+		}
+		return enc.Close()
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, u := range users {
+			var expires string
+			if u.Expires != nil {
+				expires = u.Expires.Format(time.RFC3339)
+			}
+			record := []string{
+				u.Username, u.Password, string(u.Algorithm), strconv.FormatBool(u.Disabled),
+				u.Comment, u.DisplayName, u.Email, expires,
+				strings.Join(u.Flags, " "), strings.Join(u.Groups, " "),
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %s", format)
+}
+
+// DecodeUsers reads users written by EncodeUsers in the format from r.
+func DecodeUsers(r io.Reader, format Format) ([]ExportedUser, error) {
+	var users []ExportedUser
+	switch format {
+	case FormatJSON:
+		if err := json.NewDecoder(r).Decode(&users); err != nil {
+			return nil, fmt.Errorf("malformed json: %w", err)
+		}
+	case FormatYAML:
+		if err := yaml.NewDecoder(r).Decode(&users); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("malformed yaml: %w", err)
+		}
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = len(csvHeader)
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("malformed csv: %w", err)
+		}
+		if len(records) == 0 || !slices.Equal(records[0], csvHeader) {
+			return nil, errors.New("malformed csv: missing header line")
+		}
+		for _, record := range records[1:] {
+			user, err := decodeCSVUser(record)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, user)
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+	return users, nil
+}
+
+func decodeCSVUser(record []string) (ExportedUser, error) {
+	user := ExportedUser{
+		Username:    record[0],
+		Password:    record[1],
+		Algorithm:   Algorithm(record[2]),
+		Comment:     record[4],
+		DisplayName: record[5],
+		Email:       record[6],
+		Flags:       splitList(record[8]),
+		Groups:      splitList(record[9]),
+	}
+	if record[3] != "" {
+		disabled, err := strconv.ParseBool(record[3])
+		if err != nil {
+			return user, fmt.Errorf("malformed csv: disabled of %s: %w", user.Username, err)
+		}
+		user.Disabled = disabled
+	}
+	if record[7] != "" {
+		expires, err := time.Parse(time.RFC3339, record[7])
+		if err != nil {
+			return user, fmt.Errorf("malformed csv: expires of %s: %w", user.Username, err)
+		}
+		user.Expires = &expires
+	}
+	return user, nil
+}
+
+// WriteHtpasswd writes the users as htpasswd file to w. The options are the ones the file
+// will be read with: every password is validated by the parsers, disabled accounts get the
+// disabled prefix, the metadata is written in the layout of the user fields, and the file
+// is encrypted with the encryption key. The users are refused if anything can't be written,
+// or if the file would not load with the options.
+func WriteHtpasswd(w io.Writer, users []ExportedUser, opts ...Option) error {
+	params := newParameters(opts)
+	bf := newHtpasswd(nil, params)
+
+	var buf bytes.Buffer
+	seen := make(map[string]bool)
+	for _, u := range users {
+		if !validName(u.Username) {
+			return fmt.Errorf("invalid username %q", u.Username)
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("duplicate user %s", u.Username)
+		}
+		seen[u.Username] = true
+
+		value := u.Password
+		if strings.ContainsAny(value, "\r\n") || (params.userFields != nil && strings.Contains(value, ":")) {
+			return fmt.Errorf("invalid password of %s", u.Username)
+		}
+		if value == "" && !u.Disabled {
+			return fmt.Errorf("user %s has no password", u.Username)
+		}
+		if !u.Disabled && params.disabled != "" && strings.HasPrefix(value, params.disabled) {
+			// it would be read back as disabled account
+			return fmt.Errorf("password of %s starts with the disabled prefix", u.Username)
+		}
+		if value != "" {
+			matcher, err := bf.parse(u.Username, value)
+			if err != nil {
+				return err
+			}
+			if algorithm := algorithmOf(matcher); u.Algorithm != "" && u.Algorithm != algorithm {
+				return fmt.Errorf("password of %s is %s, not %s", u.Username, algorithm, u.Algorithm)
+			}
+		}
+		if u.Disabled {
+			if params.disabled == "" {
+				return fmt.Errorf("user %s is disabled, but there is no disabled prefix", u.Username)
+			}
+			value = params.disabled + value
+		}
+
+		fields, err := formatUserFields(u.user(), params.userFields)
+		if err != nil {
+			return err
+		}
+		if len(fields) > 0 {
+			value += ":" + strings.Join(fields, ":")
+		}
+
+		buf.WriteString(u.Username + ":" + value + "\n")
+	}
+
+	entries, err := parseEntries(bytes.NewReader(buf.Bytes()), "")
+	if err != nil {
+		return err
+	}
+	if err := bf.loadEntries(entries); err != nil {
+		return err
+	}
+
+	content, err := encryptContent(buf.Bytes(), params.key)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// WriteGroups writes the group memberships of the users as group file to w, encrypted with
+// the group encryption key, if any.
+func WriteGroups(w io.Writer, users []ExportedUser, opts ...GroupOption) error {
+	members := make(map[string][]string)
+	for _, u := range users {
+		for _, group := range u.Groups {
+			if !validName(group) {
+				return fmt.Errorf("invalid group %q of %s", group, u.Username)
+			}
+			if !slices.Contains(members[group], u.Username) {
+				members[group] = append(members[group], u.Username)
+			}
+		}
+	}
+	groups := make([]string, 0, len(members))
+	for group := range members {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	var buf bytes.Buffer
+	for _, group := range groups {
+		buf.WriteString(group + ": " + strings.Join(members[group], " ") + "\n")
+	}
+
+	content, err := encryptContent(buf.Bytes(), newHTGroup(nil, "", opts).protection.key)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// splitList splits a space separated list, it returns nil for an empty list.
+func splitList(s string) []string {
+	if list := strings.Fields(s); len(list) > 0 {
+		return list
+	}
+	return nil
+}
+
+// validName reports whether name can be used as username or group name in the files.
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "#") && !strings.ContainsAny(name, ": \t\r\n")
+}
+
+// user returns the record of the exported user.
+func (u ExportedUser) user() User {
+	user := User{
+		Name:        u.Username,
+		Comment:     u.Comment,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		Disabled:    u.Disabled,
+		Flags:       u.Flags,
+	}
+	if u.Expires != nil {
+		user.Expires = *u.Expires
+	}
+	return user
+}
@@ -0,0 +1,124 @@
+package htpasswd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var exportContents = `alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=:Alice:alice@example.com:2030-01-01:admin,ops
+bob:!$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O
+carol:!
+`
+
+var exportGroups = `admins: alice
+users: alice bob
+`
+
+func exportTestUsers(t *testing.T) []ExportedUser {
+	htp, err := NewFromReader(strings.NewReader(exportContents),
+		WithUserFields(FieldDisplayName, FieldEmail, FieldExpires, FieldFlags), WithDisabledPrefix("!"))
+	assert.NoError(t, err)
+	groups, err := NewHTGroupsFromReader(strings.NewReader(exportGroups))
+	assert.NoError(t, err)
+	return Export(htp, groups)
+}
+
+func TestExport(t *testing.T) {
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []ExportedUser{
+		{
+			Username:    "alice",
+			Password:    "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+			Algorithm:   AlgorithmSha,
+			DisplayName: "Alice",
+			Email:       "alice@example.com",
+			Expires:     &expires,
+			Flags:       []string{"admin", "ops"},
+			Groups:      []string{"admins", "users"},
+		},
+		{
+			Username:  "bob",
+			Password:  "$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O",
+			Algorithm: AlgorithmBcrypt,
+			Disabled:  true,
+			Groups:    []string{"users"},
+		},
+		{
+			Username: "carol",
+			Disabled: true,
+		},
+	}, exportTestUsers(t))
+}
+
+func TestEncodeDecodeUsers(t *testing.T) {
+	users := exportTestUsers(t)
+
+	for _, format := range []Format{FormatJSON, FormatYAML, FormatCSV} {
+		var buf bytes.Buffer
+		assert.NoError(t, EncodeUsers(&buf, format, users), format)
+		decoded, err := DecodeUsers(&buf, format)
+		assert.NoError(t, err, format)
+		assert.Equal(t, users, decoded, format)
+	}
+
+	assert.Error(t, EncodeUsers(&bytes.Buffer{}, "xml", users))
+	_, err := DecodeUsers(strings.NewReader("username,password\nbob,bar\n"), FormatCSV)
+	assert.Error(t, err)
+	_, err = DecodeUsers(strings.NewReader("{"), FormatJSON)
+	assert.Error(t, err)
+}
+
+func TestWriteHtpasswd(t *testing.T) {
+	users := exportTestUsers(t)
+	opts := []Option{WithUserFields(FieldDisplayName, FieldEmail, FieldExpires, FieldFlags), WithDisabledPrefix("!")}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteHtpasswd(&buf, users, opts...))
+	assert.Equal(t, exportContents, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteGroups(&buf, users))
+	assert.Equal(t, exportGroups, buf.String())
+
+	// encrypted
+	buf.Reset()
+	assert.NoError(t, WriteHtpasswd(&buf, users, append(opts, WithEncryptionKey(testKey))...))
+	htp, err := NewFromReader(&buf, append(opts, WithEncryptionKey(testKey))...)
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "password"))
+	buf.Reset()
+	assert.NoError(t, WriteGroups(&buf, users, WithGroupEncryptionKey(testKey)))
+	groups, err := NewHTGroupsFromReader(&buf, WithGroupEncryptionKey(testKey))
+	assert.NoError(t, err)
+	assert.True(t, groups.IsUserInGroup("alice", "admins"))
+
+	for _, tc := range []struct {
+		users []ExportedUser
+		opts  []Option
+		err   string
+	}{
+		{users, []Option{WithUserFields(FieldDisplayName, FieldEmail, FieldExpires, FieldFlags)},
+			"user bob is disabled, but there is no disabled prefix"},
+		{users, []Option{WithDisabledPrefix("!")}, "display name of alice can't be written: no such field in the layout"},
+		{users, []Option{WithDisabledPrefix("!"), WithUserFields(FieldDisplayName, FieldEmail, FieldExpires)},
+			"flags of alice can't be written: no such field in the layout"},
+		{[]ExportedUser{{Username: "bob", Password: "{SHA}broken"}}, nil, "Malformed sha1({SHA}broken): illegal base64 data at input byte 4"},
+		{[]ExportedUser{{Username: "bob", Password: "bar", Algorithm: AlgorithmBcrypt}}, nil, "password of bob is plain, not bcrypt"},
+		{[]ExportedUser{{Username: "bob", Password: "bar"}}, []Option{WithParsers(Bcrypt)}, "unable to recognize password for bob in bar"},
+		{[]ExportedUser{{Username: "bob"}}, nil, "user bob has no password"},
+		{[]ExportedUser{{Username: "bob", Password: "!secret"}}, []Option{WithDisabledPrefix("!")},
+			"password of bob starts with the disabled prefix"},
+		{[]ExportedUser{{Username: "bob:x", Password: "bar"}}, nil, `invalid username "bob:x"`},
+		{[]ExportedUser{{Username: "bob", Password: "bar"}, {Username: "bob", Password: "baz"}}, nil, "duplicate user bob"},
+		{[]ExportedUser{{Username: "bob", Password: "bar"}, {Username: "Bob", Password: "baz"}},
+			[]Option{WithUsernameNormalizers(CaseFold)}, "conflicting users bob and Bob: both normalize to bob"},
+	} {
+		assert.EqualError(t, WriteHtpasswd(&bytes.Buffer{}, tc.users, tc.opts...), tc.err)
+	}
+
+	assert.Error(t, WriteGroups(&bytes.Buffer{}, []ExportedUser{{Username: "bob", Groups: []string{"a:b"}}}))
+}
@@ -0,0 +1,68 @@
+package htpasswd
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// WithCoalescing runs a single password check for identical credentials checked at the
+// same time, and shares its outcome. Browsers and API clients tend to send many requests
+// with the same Authorization header in parallel, each of which would otherwise cost a
+// bcrypt computation.
+//
+// Like WithCache, the checks are identified by an HMAC, the passwords are not kept.
+func WithCoalescing() Option {
+	return func(p *parameters) {
+		p.flights = &flightGroup{calls: make(map[cacheKey]*flightCall)}
+	}
+}
+
+// flightGroup deduplicates concurrent password checks.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[cacheKey]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	waiters int // checks which joined, guarded by the mutex of the group
+	matched bool
+	err     error
+}
+
+// do runs check, unless a check with the same key is running already. In that case it
+// waits for the outcome of that check until ctx is done.
+func (g *flightGroup) do(ctx context.Context, key cacheKey, check func() (bool, error)) (bool, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+
+		// The context of the running check is not ours, try again with our own.
+		if ctx.Err() == nil && (errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+			return g.do(ctx, key, check)
+		}
+		return call.matched, call.err
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.matched, call.err = check()
+	return call.matched, call.err
+}
@@ -0,0 +1,116 @@
+package htpasswd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingPassword is a plain text password whose checks wait for release.
+type blockingPassword struct {
+	password string
+	checks   *atomic.Int32
+	release  chan struct{}
+}
+
+func (b *blockingPassword) MatchesPassword(pw string) bool {
+	b.checks.Add(1)
+	<-b.release
+	return constantTimeEquals(pw, b.password)
+}
+
+// waitForWaiters waits until n checks have joined running checks.
+func waitForWaiters(g *flightGroup, n int) {
+	for {
+		g.mu.Lock()
+		waiters := 0
+		for _, call := range g.calls {
+			waiters += call.waiters
+		}
+		g.mu.Unlock()
+		if waiters >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	var checks atomic.Int32
+	release := make(chan struct{})
+	htp, err := NewFromReader(
+		strings.NewReader("alice:bar\n"),
+		WithParsers(func(pw string) (EncodedPasswd, error) {
+			return &blockingPassword{pw, &checks, release}, nil
+		}),
+		WithCoalescing(),
+	)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var matched atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if htp.Match("alice", "bar") {
+				matched.Add(1)
+			}
+		}()
+	}
+
+	// wait for the first check to start, and for the others to join it
+	waitForWaiters(htp.flights, 9)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(10), matched.Load())
+	assert.Equal(t, int32(1), checks.Load())
+	assert.Empty(t, htp.flights.calls)
+
+	// other passwords are not coalesced
+	assert.False(t, htp.Match("alice", "wrong"))
+}
+
+func TestFlightGroup(t *testing.T) {
+	g := &flightGroup{calls: make(map[cacheKey]*flightCall)}
+	key := cacheKey{1}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		_, err := g.do(leaderCtx, key, func() (bool, error) {
+			close(started)
+			<-release
+			return false, leaderCtx.Err()
+		})
+		leader <- err
+	}()
+	<-started
+
+	// a follower with a cancelled context gives up waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := g.do(ctx, key, func() (bool, error) { return true, nil })
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// a follower doesn't inherit the cancellation of the leader
+	follower := make(chan bool)
+	go func() {
+		matched, _ := g.do(context.Background(), key, func() (bool, error) { return true, nil })
+		follower <- matched
+	}()
+	waitForWaiters(g, 2) // including the cancelled follower
+	cancelLeader()
+	close(release)
+
+	assert.ErrorIs(t, <-leader, context.Canceled)
+	assert.True(t, <-follower)
+}
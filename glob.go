@@ -0,0 +1,110 @@
+package htpasswd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A GlobStore is a Store reading every htpasswd file matching a pattern, like
+// /etc/app/htpasswd.d/*.htpasswd, in lexical order. A user must not be in more than one of
+// the files. Files added or removed are noticed on the next Reload.
+type GlobStore struct {
+	// FS is the file system of the files, nil for the OS file system.
+	FS fs.FS
+	// Pattern is the pattern of the file names, see filepath.Match, or fs.Glob if FS is set.
+	Pattern string
+	// Key decrypts the files, if not nil, see WithEncryptionKey.
+	Key []byte
+	// PublicKey verifies the signatures of the files, if not nil, see WithPublicKey. Detached
+	// signature files matching the pattern are skipped then.
+	PublicKey ed25519.PublicKey
+
+	mu      sync.Mutex
+	origins map[string]string // file of each user on the last Load
+}
+
+// Load implements Store. The source of the entries is the file name and line number.
+func (s *GlobStore) Load(ctx context.Context) ([]Entry, string, error) {
+	var paths []string
+	var err error
+	if s.FS != nil {
+		paths, err = fs.Glob(s.FS, s.Pattern)
+	} else {
+		paths, err = filepath.Glob(s.Pattern)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("bad htpasswd file pattern %s: %w", s.Pattern, err)
+	}
+	sort.Strings(paths)
+
+	var entries []Entry
+	origins := make(map[string]string)
+	h := sha256.New()
+	for _, path := range paths {
+		if s.PublicKey != nil && strings.HasSuffix(path, SignatureSuffix) {
+			continue
+		}
+		content, err := s.readFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open htpasswd file %s: %w", path, err)
+		}
+		fileEntries, version, err := loadContent(content, path, protection{s.Key, s.PublicKey}, func() ([]byte, error) {
+			return s.readFile(path + SignatureSuffix)
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		for _, entry := range fileEntries {
+			if other, ok := origins[entry.Username]; ok && other != path {
+				return nil, "", withSource(entry.Source, fmt.Errorf("user %s is also in %s", entry.Username, other))
+			}
+			origins[entry.Username] = path
+		}
+		entries = append(entries, fileEntries...)
+		fmt.Fprintf(h, "%d:%s%d:%s", len(path), path, len(version), version)
+	}
+
+	s.mu.Lock()
+	s.origins = origins
+	s.mu.Unlock()
+
+	return entries, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ReplaceEncoding implements ReplacingStore. The encoding is replaced in the file which had
+// the user on the last Load. Files of an FS can't be written, so nothing is persisted then.
+func (s *GlobStore) ReplaceEncoding(ctx context.Context, username, oldEncoded, newEncoded string) error {
+	if s.FS != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	path, ok := s.origins[username]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("user %s is not in any htpasswd file matching %s", username, s.Pattern)
+	}
+	return replaceInFile(path, protection{s.Key, s.PublicKey}, username, oldEncoded, newEncoded)
+}
+
+func (s *GlobStore) readFile(path string) ([]byte, error) {
+	if s.FS != nil {
+		return fs.ReadFile(s.FS, path)
+	}
+	return os.ReadFile(path)
+}
+
+// NewFromGlob is like New but reads every htpasswd file matching pattern, see GlobStore.
+func NewFromGlob(pattern string, opts ...Option) (*Htpasswd, error) {
+	params := newParameters(opts)
+	return newFromStore(&GlobStore{Pattern: pattern, Key: params.key, PublicKey: params.publicKey}, params)
+}
@@ -0,0 +1,87 @@
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobStore(t *testing.T) {
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "*.htpasswd")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "10-team.htpasswd"), []byte("alice:bar\nbob:bar\n"), 0o640))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "20-carol.htpasswd"), []byte("carol:bar\n"), 0o640))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a htpasswd file\n"), 0o640))
+
+	htp, err := NewFromGlob(pattern)
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("carol", "bar"))
+
+	// added files are noticed on reload
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "30-dave.htpasswd"), []byte("dave:bar\n"), 0o640))
+	assert.NoError(t, htp.Reload())
+	assert.True(t, htp.Match("dave", "bar"))
+
+	// so are removed files
+	assert.NoError(t, os.Remove(filepath.Join(dir, "20-carol.htpasswd")))
+	assert.NoError(t, htp.Reload())
+	assert.False(t, htp.Match("carol", "bar"))
+	assert.True(t, htp.Match("dave", "bar"))
+
+	// errors tell the file and line
+	bad := filepath.Join(dir, "40-bad.htpasswd")
+	assert.NoError(t, os.WriteFile(bad, []byte("erin:bar\nfrank\n"), 0o640))
+	assert.EqualError(t, htp.Reload(), bad+":2: malformed line, no colon: frank")
+	assert.NoError(t, os.WriteFile(bad, []byte("erin:bar\nalice:baz\n"), 0o640))
+	assert.EqualError(t, htp.Reload(),
+		bad+":2: user alice is also in "+filepath.Join(dir, "10-team.htpasswd"))
+	assert.True(t, htp.Match("alice", "bar"))
+
+	// no files, no users
+	htp, err = NewFromGlob(filepath.Join(dir, "*.missing"))
+	assert.NoError(t, err)
+	assert.False(t, htp.Match("alice", "bar"))
+
+	_, err = NewFromGlob("[")
+	assert.Error(t, err)
+}
+
+func TestGlobStoreFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"htpasswd.d/b.htpasswd": {Data: []byte("bob:bar\n")},
+		"htpasswd.d/a.htpasswd": {Data: []byte("alice:bar\n")},
+		"htpasswd.d/c.txt":      {Data: []byte("carol:bar\n")},
+	}
+
+	htp, err := NewFromStore(&GlobStore{FS: fsys, Pattern: "htpasswd.d/*.htpasswd"})
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("bob", "bar"))
+	assert.False(t, htp.Match("carol", "bar"))
+}
+
+func TestGlobStoreRehash(t *testing.T) {
+	dir := t.TempDir()
+	team := filepath.Join(dir, "team.htpasswd")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "alice.htpasswd"), []byte("alice:bar\n"), 0o640))
+	assert.NoError(t, os.WriteFile(team, []byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o640))
+
+	var rehashErr error
+	htp, err := NewFromGlob(filepath.Join(dir, "*.htpasswd"), WithRehash(
+		RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}},
+		BcryptEncoder(4),
+		func(_ string, err error) { rehashErr = err },
+	))
+	assert.NoError(t, err)
+
+	assert.True(t, htp.Match("bob", "password"))
+	assert.NoError(t, rehashErr)
+
+	content, err := os.ReadFile(team)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "bob:$2a$04$")
+}
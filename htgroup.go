@@ -12,21 +12,77 @@ package htpasswd
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/ed25519"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"sort"
 	"strings"
 	"sync/atomic"
 )
 
 // Data structure for users and theirs groups (map).
-// The map key is the user, the value is an array of groups.
+// The map key is the normalized user, the value is an array of groups.
 type userGroupMap map[string][]string
 
 // A HTGroup encompasses an Apache-style group file.
 type HTGroup struct {
-	filePath   string
-	userGroups atomic.Pointer[userGroupMap]
+	fsys        fs.FS // nil for the OS file system
+	filePath    string
+	protection  protection // see WithGroupEncryptionKey and WithGroupPublicKey
+	normalizers []UsernameNormalizer
+	userGroups  atomic.Pointer[userGroupMap]
+}
+
+type groupParameters struct {
+	key         []byte
+	publicKey   ed25519.PublicKey
+	normalizers []UsernameNormalizer
+}
+
+// A GroupOption configures a HTGroup.
+type GroupOption func(*groupParameters)
+
+// WithGroupEncryptionKey decrypts the group file with key, like WithEncryptionKey does for
+// htpasswd files. Unencrypted group files are refused.
+func WithGroupEncryptionKey(key []byte) GroupOption {
+	return func(p *groupParameters) {
+		p.key = key
+	}
+}
+
+// WithGroupPublicKey verifies the signature of the group file with key, like WithPublicKey
+// does for htpasswd files. Unsigned group files are refused.
+func WithGroupPublicKey(key ed25519.PublicKey) GroupOption {
+	return func(p *groupParameters) {
+		p.publicKey = key
+	}
+}
+
+// WithGroupUsernameNormalizers sets the normalizers applied, in order, to the members of the
+// group file when it is loaded and to the usernames given to IsUserInGroup and
+// GetUserGroups. Pass the normalizers given to WithUsernameNormalizers, so a user matched
+// as "ALICE" is in the groups of "alice". A member which fails to normalize is an error
+// when loading.
+func WithGroupUsernameNormalizers(normalizers ...UsernameNormalizer) GroupOption {
+	return func(p *groupParameters) {
+		p.normalizers = normalizers
+	}
+}
+
+func newHTGroup(fsys fs.FS, filename string, opts []GroupOption) *HTGroup {
+	params := &groupParameters{}
+	for _, opt := range opts {
+		opt(params)
+	}
+	return &HTGroup{
+		fsys:        fsys,
+		filePath:    filename,
+		protection:  protection{params.key, params.publicKey},
+		normalizers: params.normalizers,
+	}
 }
 
 // NewHTGroup creates a HTGroup from an Apache-style group file.
@@ -34,45 +90,77 @@ type HTGroup struct {
 // The filename must exist and be accessible to the process, as well as being a valid group file.
 //
 // bad is a function, which if not nil will be called for each malformed or rejected entry in the group file.
-func NewHTGroup(filename string) (*HTGroup, error) {
-	htGroup := HTGroup{
-		filePath: filename,
-	}
-	return &htGroup, htGroup.Reload()
+func NewHTGroup(filename string, opts ...GroupOption) (*HTGroup, error) {
+	htGroup := newHTGroup(nil, filename, opts)
+	return htGroup, htGroup.Reload()
+}
+
+// NewHTGroupFromFS is like NewHTGroup but reads the group file at path from fsys, e.g. an
+// embed.FS. Reload rereads it from fsys.
+func NewHTGroupFromFS(fsys fs.FS, path string, opts ...GroupOption) (*HTGroup, error) {
+	htGroup := newHTGroup(fsys, path, opts)
+	return htGroup, htGroup.Reload()
 }
 
 // NewHTGroupsFromReader is like NewHTGroup but reads from r instead of a named file.
-func NewHTGroupsFromReader(r io.Reader) (*HTGroup, error) {
-	htGroup := HTGroup{}
+func NewHTGroupsFromReader(r io.Reader, opts ...GroupOption) (*HTGroup, error) {
+	htGroup := newHTGroup(nil, "", opts)
 
 	readFileErr := htGroup.ReloadFromReader(r)
 	if readFileErr != nil {
 		return nil, readFileErr
 	}
 
-	return &htGroup, nil
+	return htGroup, nil
 }
 
 // Reload rereads the group file.
 func (g *HTGroup) Reload() error {
-	file, err := os.Open(g.filePath)
+	var file fs.File
+	var err error
+	if g.fsys != nil {
+		file, err = g.fsys.Open(g.filePath)
+	} else {
+		file, err = os.Open(g.filePath)
+	}
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	return g.ReloadFromReader(file)
+	return g.reload(file, g.filePath, g.readDetached)
+}
+
+// readDetached reads the detached signature of the group file.
+func (g *HTGroup) readDetached() ([]byte, error) {
+	if g.fsys != nil {
+		return fs.ReadFile(g.fsys, g.filePath+SignatureSuffix)
+	}
+	return os.ReadFile(g.filePath + SignatureSuffix)
 }
 
 // ReloadFromReader rereads the group file from a Reader.
 func (g *HTGroup) ReloadFromReader(r io.Reader) error {
+	return g.reload(r, "", nil)
+}
+
+func (g *HTGroup) reload(r io.Reader, name string, readDetached func() ([]byte, error)) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("scanning group file failed: %w", err)
+	}
+	content, err = g.protection.open(content, name, readDetached)
+	if err != nil {
+		return err
+	}
+
 	userGroups := make(userGroupMap)
 
-	scanner := bufio.NewScanner(r)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		if err := processLine(&userGroups, line); err != nil {
+		if err := processLine(&userGroups, line, g.normalizers); err != nil {
 			return err
 		}
 	}
@@ -85,7 +173,7 @@ func (g *HTGroup) ReloadFromReader(r io.Reader) error {
 	return nil
 }
 
-func processLine(userGroups *userGroupMap, rawLine string) error {
+func processLine(userGroups *userGroupMap, rawLine string, normalizers []UsernameNormalizer) error {
 	// ignore empty line
 	line := strings.TrimSpace(rawLine)
 	if line == "" {
@@ -105,6 +193,14 @@ func processLine(userGroups *userGroupMap, rawLine string) error {
 	var group = strings.TrimSpace(groupAndUsers[0])
 	var users = strings.Fields(groupAndUsers[1])
 	for _, user := range users {
+		user, err := normalizeUsername(normalizers, user)
+		if err != nil {
+			return err
+		}
+		if containsGroup((*userGroups)[user], group) {
+			// the user is listed twice, possibly in different forms
+			continue
+		}
 		if (*userGroups)[user] == nil {
 			(*userGroups)[user] = []string{}
 		}
@@ -124,6 +220,10 @@ func (g *HTGroup) IsUserInGroup(user string, group string) bool {
 // GetUserGroups reads all groups of a user.
 // Returns all groups as a string array or an empty array.
 func (g *HTGroup) GetUserGroups(user string) []string {
+	user, err := normalizeUsername(g.normalizers, user)
+	if err != nil {
+		return []string{}
+	}
 	groups := (*g.userGroups.Load())[user]
 
 	if groups == nil {
@@ -132,6 +232,55 @@ func (g *HTGroup) GetUserGroups(user string) []string {
 	return groups
 }
 
+// Groups returns the names of all groups with at least one member, sorted.
+func (g *HTGroup) Groups() []string {
+	seen := make(map[string]bool)
+	var groups []string
+	for _, userGroups := range *g.userGroups.Load() {
+		for _, group := range userGroups {
+			if !seen[group] {
+				seen[group] = true
+				groups = append(groups, group)
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Members returns the normalized users in a group, sorted, or nil if there is no such group.
+func (g *HTGroup) Members(group string) []string {
+	var members []string
+	for user, userGroups := range *g.userGroups.Load() {
+		if containsGroup(userGroups, group) {
+			members = append(members, user)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// HasGroup reports whether a group has at least one member.
+func (g *HTGroup) HasGroup(group string) bool {
+	for _, userGroups := range *g.userGroups.Load() {
+		if containsGroup(userGroups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Users returns the normalized users in at least one group, sorted.
+func (g *HTGroup) Users() []string {
+	table := *g.userGroups.Load()
+	users := make([]string, 0, len(table))
+	for user := range table {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
 func containsGroup(groups []string, group string) bool {
 	for _, g := range groups {
 		if g == group {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -84,3 +85,52 @@ func TestGroups(t *testing.T) {
 	assert.Len(t, htGroup.GetUserGroups("user3"), 1)
 	assert.Len(t, htGroup.GetUserGroups("unknownuser"), 0)
 }
+
+func TestGroupsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{"conf/groups": {Data: []byte(contents)}}
+
+	htGroup, err := NewHTGroupFromFS(fsys, "conf/groups")
+	assert.NoError(t, err)
+	assert.True(t, htGroup.IsUserInGroup("user1", "admins"))
+	assert.False(t, htGroup.IsUserInGroup("user2", "admins"))
+
+	// Reload reads from the file system again
+	fsys["conf/groups"] = &fstest.MapFile{Data: []byte(contents2)}
+	assert.NoError(t, htGroup.Reload())
+	assert.True(t, htGroup.IsUserInGroup("user2", "admins"))
+
+	_, err = NewHTGroupFromFS(fsys, "conf/missing")
+	assert.Error(t, err)
+}
+
+func TestGroupsIntrospection(t *testing.T) {
+	htGroup, err := NewHTGroupsFromReader(strings.NewReader("users: user3 user1 user2\nadmins: user1\n"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"admins", "users"}, htGroup.Groups())
+	assert.Equal(t, []string{"user1", "user2", "user3"}, htGroup.Members("users"))
+	assert.Equal(t, []string{"user1"}, htGroup.Members("admins"))
+	assert.Nil(t, htGroup.Members("unknowngroup"))
+	assert.True(t, htGroup.HasGroup("admins"))
+	assert.False(t, htGroup.HasGroup("unknowngroup"))
+	assert.Equal(t, []string{"user1", "user2", "user3"}, htGroup.Users())
+}
+
+func TestGroupUsernameNormalizers(t *testing.T) {
+	htGroup, err := NewHTGroupsFromReader(strings.NewReader("admins: Alice\nusers: alice ALICE bob\n"),
+		WithGroupUsernameNormalizers(CaseFold))
+	assert.NoError(t, err)
+	assert.True(t, htGroup.IsUserInGroup("ALICE", "admins"))
+	assert.True(t, htGroup.IsUserInGroup("alice", "admins"))
+	assert.Equal(t, []string{"admins", "users"}, htGroup.GetUserGroups("aLiCe"))
+	assert.Equal(t, []string{"alice", "bob"}, htGroup.Members("users"))
+
+	// the same normalizers on both sides
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"), WithUsernameNormalizers(CaseFold))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("ALICE", "bar"))
+	assert.True(t, htGroup.IsUserInGroup("ALICE", "admins"))
+
+	_, err = NewHTGroupsFromReader(strings.NewReader("admins: \u0007\n"), WithGroupUsernameNormalizers(PRECISUsername))
+	assert.Error(t, err)
+}
@@ -14,12 +14,16 @@
 package htpasswd
 
 import (
-	"bufio"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // An EncodedPasswd is created from the encoded password in a password file by a PasswdParser.
@@ -32,6 +36,17 @@ type EncodedPasswd interface {
 	MatchesPassword(pw string) bool
 }
 
+// A ContextEncodedPasswd is an EncodedPasswd whose check can be cancelled. An EncodedPasswd
+// with an expensive comparison function should implement it, MatchContext uses it if it is
+// available.
+type ContextEncodedPasswd interface {
+	EncodedPasswd
+
+	// MatchesPasswordContext is like MatchesPassword, but gives up with the error of ctx
+	// once ctx is done.
+	MatchesPasswordContext(ctx context.Context, pw string) (bool, error)
+}
+
 // PasswdParser examines an encoded password, and if it is formatted correctly and sane, return an
 // EncodedPasswd which will recognize it.
 //
@@ -43,13 +58,46 @@ type EncodedPasswd interface {
 // already included in this package. Use sha.c as a template, it is simple but not too simple.
 type PasswdParser func(pw string) (EncodedPasswd, error)
 
-type passwdTable map[string]EncodedPasswd
+// PasswdEncoder encodes a password, with a fresh salt where the hashing system uses one, to
+// the form a PasswdParser understands.
+type PasswdEncoder func(pw string) (string, error)
+
+// passwdEntry is a user of the password file.
+type passwdEntry struct {
+	user    User
+	encoded string // the encoded password without the disabled prefix and the user fields
+	matcher EncodedPasswd
+}
+
+// passwdTable maps the normalized username to its entry.
+type passwdTable map[string]*passwdEntry
 
 // A Htpasswd encompasses an Apache-style htpasswd file for HTTP Basic authentication
 type Htpasswd struct {
-	filePath string
-	passwds  atomic.Pointer[passwdTable]
-	parsers  []PasswdParser
+	store       Store // nil if created from a reader
+	passwds     atomic.Pointer[passwdTable]
+	parsers     []PasswdParser
+	normalizers []UsernameNormalizer
+	userFields  []UserField // nil unless extra fields are split off the encoded password
+	disabled    string      // prefix of the encoded password marking a disabled account
+	protection  protection  // of readers, see WithEncryptionKey and WithPublicKey
+	now         func() time.Time
+
+	constantTime bool
+	dummy        atomic.Pointer[EncodedPasswd] // checked for unknown users, see WithConstantTimeUnknownUsers
+	dummyEncoded string                        // see WithDummyPassword
+
+	rehash   *rehash
+	rehashMu sync.Mutex // serializes rehashes, and replacing the users with the dummy password
+
+	lockout *lockout
+	limiter *limiter
+	cache   *verifyCache
+	flights *flightGroup
+	hasher  *credentialHasher // keys of cache and flights
+
+	reloadMu sync.Mutex // serializes reloads
+	version  string     // of the entries of the store last loaded
 }
 
 // DefaultSystems is an array of PasswdParser including all builtin parsers. Notice that Plain is last, since it accepts anything
@@ -63,7 +111,20 @@ var DefaultSystems = []PasswdParser{
 }
 
 type parameters struct {
-	parsers []PasswdParser
+	parsers      []PasswdParser
+	normalizers  []UsernameNormalizer
+	userFields   []UserField
+	disabled     string
+	now          func() time.Time
+	constantTime bool
+	dummy        string
+	key          []byte
+	publicKey    ed25519.PublicKey
+	rehash       *rehash
+	lockout      *lockout
+	limiter      *limiter
+	cache        *verifyCache
+	flights      *flightGroup
 }
 
 type Option func(*parameters)
@@ -74,6 +135,78 @@ func WithParsers(parsers ...PasswdParser) Option {
 	}
 }
 
+// WithUsernameNormalizers sets the normalizers applied, in order, to the usernames of the
+// password file and to the username given to Match. Two entries of the password file
+// which normalize to the same username are rejected as conflict.
+func WithUsernameNormalizers(normalizers ...UsernameNormalizer) Option {
+	return func(p *parameters) {
+		p.normalizers = normalizers
+	}
+}
+
+// WithUserFields splits extra colon separated fields off the encoded password, as in
+// "user:passwd-encoding:field1:field2", and maps them to the User record in the order of
+// fields. Fields beyond the layout are kept in User.Fields only. Without this option
+// everything after the first colon is the encoded password.
+//
+// Be careful: plain text passwords containing a colon can't be used in this mode.
+func WithUserFields(fields ...UserField) Option {
+	return func(p *parameters) {
+		p.userFields = append([]UserField{}, fields...)
+	}
+}
+
+// WithDisabledPrefix marks accounts as disabled whose encoded password starts with prefix,
+// like "!" in shadow files. The rest of the encoded password is parsed as usual, so the
+// account is enabled again by removing the prefix. A disabled account never matches.
+//
+// Be careful: plain text passwords starting with prefix are disabled as well.
+func WithDisabledPrefix(prefix string) Option {
+	return func(p *parameters) {
+		p.disabled = prefix
+	}
+}
+
+// WithClock sets the function used to get the current time when checking account expiry.
+// It defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(p *parameters) {
+		p.now = now
+	}
+}
+
+func newParameters(opts []Option) *parameters {
+	params := &parameters{parsers: DefaultSystems, now: time.Now}
+	for _, opt := range opts {
+		opt(params)
+	}
+	return params
+}
+
+func newHtpasswd(store Store, params *parameters) *Htpasswd {
+	bf := &Htpasswd{
+		store:       store,
+		parsers:     params.parsers,
+		normalizers: params.normalizers,
+		userFields:  params.userFields,
+		disabled:    params.disabled,
+		now:         params.now,
+		protection:  protection{params.key, params.publicKey},
+
+		constantTime: params.constantTime,
+		dummyEncoded: params.dummy,
+		rehash:       params.rehash,
+		lockout:      params.lockout,
+		limiter:      params.limiter,
+		cache:        params.cache,
+		flights:      params.flights,
+	}
+	if bf.cache != nil || bf.flights != nil {
+		bf.hasher = newCredentialHasher()
+	}
+	return bf
+}
+
 // New creates an Htpasswd from an Apache-style htpasswd file for HTTP Basic Authentication.
 //
 // The realm is presented to the user in the login dialog.
@@ -87,130 +220,247 @@ func WithParsers(parsers ...PasswdParser) Option {
 // bad is a function, which if not nil will be called for each malformed or rejected entry in
 // the password file.
 func New(filename string, opts ...Option) (*Htpasswd, error) {
-	params := &parameters{parsers: DefaultSystems}
-	for _, opt := range opts {
-		opt(params)
+	params := newParameters(opts)
+	return newFromStore(&FileStore{Path: filename, Key: params.key, PublicKey: params.publicKey}, params)
+}
+
+// NewFromFS is like New but reads the htpasswd file at path from fsys, e.g. an embed.FS.
+// Reload rereads it from fsys.
+func NewFromFS(fsys fs.FS, path string, opts ...Option) (*Htpasswd, error) {
+	params := newParameters(opts)
+	return newFromStore(&FSStore{FS: fsys, Path: path, Key: params.key, PublicKey: params.publicKey}, params)
+}
+
+// NewFromStore is like New but loads the users from store instead of a named file.
+//
+// WithEncryptionKey and WithPublicKey are refused, as stores have their own keys, see
+// FileStore. Otherwise a store would silently load unencrypted or unsigned users.
+func NewFromStore(store Store, opts ...Option) (*Htpasswd, error) {
+	params := newParameters(opts)
+	if params.key != nil {
+		return nil, errors.New("WithEncryptionKey can't be applied to a store, set the key of the store")
+	}
+	if params.publicKey != nil {
+		return nil, errors.New("WithPublicKey can't be applied to a store, set the public key of the store")
 	}
+	return newFromStore(store, params)
+}
 
-	bf := Htpasswd{
-		filePath: filename,
-		parsers:  params.parsers,
+func newFromStore(store Store, params *parameters) (*Htpasswd, error) {
+	bf := newHtpasswd(store, params)
+
+	if s, ok := store.(interface{ inheritNormalizers([]UsernameNormalizer) }); ok {
+		s.inheritNormalizers(params.normalizers)
 	}
 
 	if err := bf.Reload(); err != nil {
 		return nil, err
 	}
 
-	return &bf, nil
+	return bf, nil
 }
 
 // NewFromReader is like new but reads from r instead of a named file. Calling
 // Reload on the returned Htpasswd will result in an error; use
 // ReloadFromReader instead.
 func NewFromReader(r io.Reader, opts ...Option) (*Htpasswd, error) {
-	params := &parameters{parsers: DefaultSystems}
-	for _, opt := range opts {
-		opt(params)
-	}
-
-	bf := Htpasswd{
-		parsers: params.parsers,
-	}
+	bf := newHtpasswd(nil, newParameters(opts))
 
 	if err := bf.ReloadFromReader(r); err != nil {
 		return nil, err
 	}
 
-	return &bf, nil
+	return bf, nil
 }
 
 // Match checks the username and password combination to see if it represents
-// a valid account from the htpassword file.
+// a valid account from the htpassword file. Disabled and expired accounts never match.
 func (bf *Htpasswd) Match(username, password string) bool {
-	matcher, ok := (*bf.passwds.Load())[username]
+	_, err := bf.Authenticate(username, password)
+	return err == nil
+}
+
+// MatchContext is like Match, but gives up once ctx is done. The context is checked before
+// the password is checked and while waiting for WithMaxConcurrentChecks. A check which has
+// started can only be interrupted if the EncodedPasswd is a ContextEncodedPasswd, which is
+// not the case for any of the builtin algorithms.
+func (bf *Htpasswd) MatchContext(ctx context.Context, username, password string) bool {
+	_, err := bf.AuthenticateContext(ctx, username, password)
+	return err == nil
+}
 
-	if ok && matcher.MatchesPassword(password) {
-		// we are good
-		return true
+// User returns the record of a user of the htpasswd file.
+func (bf *Htpasswd) User(username string) (User, bool) {
+	_, entry, ok, _ := bf.lookup(context.Background(), username)
+	if !ok {
+		return User{}, false
+	}
+	return entry.user.clone(), true
+}
+
+// lookup finds the entry of a user by the normalized username, which is returned as key.
+// Users who were not loaded are looked up in the store, if it is a LookupStore.
+func (bf *Htpasswd) lookup(ctx context.Context, username string) (string, *passwdEntry, bool, error) {
+	key, err := normalizeUsername(bf.normalizers, username)
+	if err != nil {
+		return "", nil, false, nil
 	}
 
-	return false
+	if entry, ok := (*bf.passwds.Load())[key]; ok {
+		return key, entry, true, nil
+	}
+
+	store, ok := bf.store.(LookupStore)
+	if !ok {
+		return key, nil, false, nil
+	}
+	found, ok, err := store.Lookup(ctx, key)
+	if err != nil {
+		return key, nil, false, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	if !ok {
+		return key, nil, false, nil
+	}
+	table := passwdTable{}
+	if err := bf.addHtpasswdUser(&table, found); err != nil {
+		return key, nil, false, withSource(found.Source, err)
+	}
+	entry, ok := table[key]
+	return key, entry, ok, nil
 }
 
-// Reload rereads the htpasswd file.
+// Reload rereads the htpasswd file, or the store.
 // You will need to call this to notice any changes to the password file.
 // This function is thread safe. Someone versed in fsnotify might make it
 // happen automatically. However, you might also connect a SIGHUP handler to
 // this function.
 func (bf *Htpasswd) Reload() error {
-	f, err := os.Open(bf.filePath)
+	if bf.store == nil {
+		return errors.New("no htpasswd file to reload, use ReloadFromReader")
+	}
+
+	entries, version, err := bf.store.Load(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to open htpasswd file %s: %w", bf.filePath, err)
+		return err
 	}
-	defer f.Close()
 
-	return bf.ReloadFromReader(f)
+	bf.reloadMu.Lock()
+	defer bf.reloadMu.Unlock()
+
+	if version != "" && version == bf.version {
+		return nil
+	}
+	if err := bf.loadEntries(entries); err != nil {
+		return err
+	}
+	bf.version = version
+
+	return nil
 }
 
 // ReloadFromReader is like Reload but reads credentials from r instead of a named
 // file. If Htpasswd was created by New, it is okay to call Reload and
 // ReloadFromReader as desired.
 func (bf *Htpasswd) ReloadFromReader(r io.Reader) error {
-	newPasswdMap := &passwdTable{}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("scanning htpasswd file failed: %w", err)
+	}
+	entries, _, err := loadContent(content, "", bf.protection, nil)
+	if err != nil {
+		return err
+	}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
+	bf.reloadMu.Lock()
+	defer bf.reloadMu.Unlock()
 
-		if perr := bf.addHtpasswdUser(newPasswdMap, line); perr != nil {
-			return perr
-		}
+	if err := bf.loadEntries(entries); err != nil {
+		return err
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("scanning htpasswd file failed: %w", err)
+	bf.version = ""
+
+	return nil
+}
+
+// loadEntries parses the entries and replaces the users by them.
+func (bf *Htpasswd) loadEntries(entries []Entry) error {
+	newPasswdMap := &passwdTable{}
+	for _, entry := range entries {
+		if err := bf.addHtpasswdUser(newPasswdMap, entry); err != nil {
+			return withSource(entry.Source, err)
+		}
 	}
 
+	// a rehash replaces the table and the dummy password together as well
+	bf.rehashMu.Lock()
+	defer bf.rehashMu.Unlock()
+	if bf.constantTime {
+		dummy, err := bf.makeDummy(*newPasswdMap)
+		if err != nil {
+			return err
+		}
+		bf.dummy.Store(&dummy)
+	}
 	bf.passwds.Store(newPasswdMap)
 
 	return nil
 }
 
-// addHtpasswdUser processes a line from an htpasswd file and add it to the user/password map. We may
-// encounter some malformed lines, this will not be an error, but we will log them if
-// the caller has given us a logger.
-func (bf *Htpasswd) addHtpasswdUser(pwmap *passwdTable, rawLine string) error {
-	// ignore empty line
-	line := strings.TrimSpace(rawLine)
-	if line == "" {
-		return nil
+// addHtpasswdUser processes an entry, a line from an htpasswd file, and adds it to the
+// user/password map.
+func (bf *Htpasswd) addHtpasswdUser(pwmap *passwdTable, entry Entry) error {
+	user := entry.Username
+	encoding := entry.Value
+
+	key, err := normalizeUsername(bf.normalizers, user)
+	if err != nil {
+		return err
+	}
+	if existing, ok := (*pwmap)[key]; ok && existing.user.Name != user {
+		return fmt.Errorf("conflicting users %s and %s: both normalize to %s", existing.user.Name, user, key)
 	}
 
-	// ignore comment line. Inline comments are not allowed
-	if strings.HasPrefix(line, "#") {
-		return nil
+	record := User{Name: user}
+	if bf.userFields != nil {
+		fields := strings.Split(encoding, ":")
+		encoding = fields[0]
+		if err := parseUserFields(&record, bf.userFields, fields[1:]); err != nil {
+			return err
+		}
 	}
 
-	// split "user:encoding" at colon
-	parts := strings.SplitN(line, ":", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("malformed line, no colon: %s", line)
+	if bf.disabled != "" && strings.HasPrefix(encoding, bf.disabled) {
+		record.Disabled = true
+		encoding = strings.TrimPrefix(encoding, bf.disabled)
+
+		// a disabled account might not have a password at all
+		if encoding == "" {
+			(*pwmap)[key] = &passwdEntry{user: record}
+			return nil
+		}
 	}
 
-	user := parts[0]
-	encoding := parts[1]
+	matcher, err := bf.parse(user, encoding)
+	if err != nil {
+		return err
+	}
+	(*pwmap)[key] = &passwdEntry{user: record, encoded: encoding, matcher: matcher}
+	return nil
+}
 
+// parse turns the encoded password of user into an EncodedPasswd using the parsers.
+func (bf *Htpasswd) parse(user, encoding string) (EncodedPasswd, error) {
 	// give each parser a shot. The first one to produce a matcher wins.
 	// If one produces an error then stop (to prevent Plain from catching it)
 	for _, p := range bf.parsers {
 		matcher, err := p(encoding)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if matcher != nil {
-			(*pwmap)[user] = matcher
-			return nil // we are done, we took to first match
+			return matcher, nil // we are done, we took to first match
 		}
 	}
 
-	return fmt.Errorf("unable to recognize password for %s in %s", user, encoding)
+	return nil, fmt.Errorf("unable to recognize password for %s in %s", user, encoding)
 }
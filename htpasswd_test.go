@@ -1,10 +1,11 @@
 package htpasswd
 
 import (
-	_ "embed"
+	"embed"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 type testUser struct {
@@ -240,6 +241,9 @@ var testCryptSha256 string
 //go:embed testdata/htpasswd/testCryptSha512
 var testCryptSha512 string
 
+//go:embed testdata/htpasswd
+var testdataFS embed.FS
+
 func testSystemReader(t *testing.T, name string, contents string) {
 	r := strings.NewReader(contents)
 
@@ -315,3 +319,48 @@ func Test_CryptSha256File(t *testing.T)   { testSystem(t, "crypt-sha256", testCr
 
 func Test_CryptSha512Reader(t *testing.T) { testSystemReader(t, "crypt-sha512", testCryptSha512) }
 func Test_CryptSha512File(t *testing.T)   { testSystem(t, "crypt-sha512", testCryptSha512) }
+
+func Test_FS(t *testing.T) {
+	for _, name := range []string{
+		"textPlain", "textApr1", "textSha", "textBcrypt", "textSsha", "textMd5Crypt",
+		"testCryptSha256", "testCryptSha512",
+	} {
+		htp, err := NewFromFS(testdataFS, "testdata/htpasswd/"+name)
+		if err != nil {
+			t.Fatalf("Failed to read htpasswd file %s from embed.FS: %s", name, err.Error())
+		}
+		for _, u := range testUsers {
+			if good := htp.Match(u.username, u.password); !good {
+				t.Errorf("%s user %s, password %s failed to authenticate: %t", name, u.username, u.password, good)
+			}
+		}
+	}
+}
+
+func Test_FSReload(t *testing.T) {
+	fsys := fstest.MapFS{"htpasswd": {Data: []byte("bob:bar\n")}}
+
+	htp, err := NewFromFS(fsys, "htpasswd")
+	if err != nil {
+		t.Fatalf("Failed to read htpasswd file: %s", err.Error())
+	}
+	if !htp.Match("bob", "bar") {
+		t.Errorf("bob failed to authenticate")
+	}
+
+	fsys["htpasswd"] = &fstest.MapFile{Data: []byte("bob:baz\n")}
+	if err := htp.Reload(); err != nil {
+		t.Fatalf("Failed to reload htpasswd file: %s", err.Error())
+	}
+	if htp.Match("bob", "bar") || !htp.Match("bob", "baz") {
+		t.Errorf("Reload didn't pick up the new password of bob")
+	}
+
+	delete(fsys, "htpasswd")
+	if err := htp.Reload(); err == nil {
+		t.Errorf("Reload of a missing file succeeded")
+	}
+	if !htp.Match("bob", "baz") {
+		t.Errorf("failed Reload replaced the users")
+	}
+}
@@ -1,24 +1,86 @@
 package htpasswd
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 )
 
+type middlewareParameters struct {
+	throttle *Throttle
+}
+
+// A MiddlewareOption configures the BasicAuthMiddleware.
+type MiddlewareOption func(*middlewareParameters)
+
+// WithThrottle limits the rate of failed login attempts, see Throttle.
+func WithThrottle(throttle *Throttle) MiddlewareOption {
+	return func(p *middlewareParameters) {
+		p.throttle = throttle
+	}
+}
+
 // BasicAuthMiddleware implements a simple middleware handler for adding basic http auth to a route.
-func BasicAuthMiddleware(realm string, htpasswd *Htpasswd) func(next http.Handler) http.Handler {
+//
+// It answers with 401 Unauthorized if the credentials don't match, and with 503 Service
+// Unavailable if the password can't be checked because of WithMaxConcurrentChecks, because
+// the user store is unavailable, or because the request context is done.
+func BasicAuthMiddleware(realm string, htpasswd *Htpasswd, opts ...MiddlewareOption) func(next http.Handler) http.Handler {
+	params := &middlewareParameters{}
+	for _, opt := range opts {
+		opt(params)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
 				user, pass, ok := r.BasicAuth()
-				if !ok || !htpasswd.Match(user, pass) {
-					w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, realm))
-					w.WriteHeader(http.StatusUnauthorized)
+				if !ok {
+					unauthorized(w, realm)
+					return
+				}
+
+				throttle := params.throttle
+				var ip, key string
+				if throttle != nil {
+					ip = throttle.clientIP(r)
+					// all forms of the username count for the same user
+					var err error
+					if key, err = htpasswd.Normalize(user); err != nil {
+						key = user
+					}
+					if delay := throttle.delay(key, ip); delay > 0 {
+						w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+						w.WriteHeader(http.StatusTooManyRequests)
+						return
+					}
+				}
+
+				_, err := htpasswd.AuthenticateContext(r.Context(), user, pass)
+				if errors.Is(err, ErrBusy) || errors.Is(err, ErrUnavailable) || (err != nil && r.Context().Err() != nil) {
+					w.WriteHeader(http.StatusServiceUnavailable)
 					return
 				}
+				if err != nil {
+					if throttle != nil {
+						throttle.fail(key, ip)
+					}
+					unauthorized(w, realm)
+					return
+				}
+				if throttle != nil {
+					throttle.succeed(key)
+				}
 
 				next.ServeHTTP(w, r)
 			},
 		)
 	}
 }
+
+func unauthorized(w http.ResponseWriter, realm string) {
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, realm))
+	w.WriteHeader(http.StatusUnauthorized)
+}
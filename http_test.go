@@ -0,0 +1,129 @@
+package htpasswd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("ok"))
+})
+
+func serveBasicAuth(handler http.Handler, user, password string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"))
+	assert.NoError(t, err)
+	handler := BasicAuthMiddleware("restricted", htp)(okHandler)
+
+	w := serveBasicAuth(handler, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="restricted"`, w.Header().Get("WWW-Authenticate"))
+
+	w = serveBasicAuth(handler, "alice", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serveBasicAuth(handler, "alice", "bar")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestBasicAuthMiddlewareThrottle(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"))
+	assert.NoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	throttle := NewThrottle(NewMemoryThrottleStore(1, 1500*time.Millisecond, time.Minute))
+	throttle.now = func() time.Time { return now }
+	handler := BasicAuthMiddleware("restricted", htp, WithThrottle(throttle))(okHandler)
+
+	w := serveBasicAuth(handler, "alice", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serveBasicAuth(handler, "alice", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// even the right password has to wait
+	w = serveBasicAuth(handler, "alice", "bar")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	// the client IP is throttled for other users as well
+	w = serveBasicAuth(handler, "bob", "bar")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	now = now.Add(1500 * time.Millisecond)
+	w = serveBasicAuth(handler, "alice", "bar")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Zero(t, throttle.store.Delay("user:alice", now))
+}
+
+func TestBasicAuthMiddlewareThrottleNormalized(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"),
+		WithUsernameNormalizers(CaseFold))
+	assert.NoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	throttle := NewThrottle(NewMemoryThrottleStore(2, time.Second, time.Minute))
+	throttle.now = func() time.Time { return now }
+	handler := BasicAuthMiddleware("restricted", htp, WithThrottle(throttle))(okHandler)
+
+	serve := func(user, password, ip string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.SetBasicAuth(user, password)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// every case variant from another client IP
+	assert.Equal(t, http.StatusUnauthorized, serve("alice", "wrong", "192.0.2.1"))
+	assert.Equal(t, http.StatusUnauthorized, serve("Alice", "wrong", "192.0.2.2"))
+	assert.Equal(t, http.StatusUnauthorized, serve("ALICE", "wrong", "192.0.2.3"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("aLice", "wrong", "192.0.2.4"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("alice", "bar", "192.0.2.5"))
+	assert.NotZero(t, throttle.store.Delay("user:alice", now))
+}
+
+func TestBasicAuthMiddlewareBusy(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"), WithMaxConcurrentChecks(1, 0))
+	assert.NoError(t, err)
+	handler := BasicAuthMiddleware("restricted", htp)(okHandler)
+
+	assert.NoError(t, htp.limiter.acquire(context.Background()))
+	w := serveBasicAuth(handler, "alice", "bar")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	htp.limiter.release()
+	w = serveBasicAuth(handler, "alice", "bar")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestBasicAuthMiddlewareCancelled(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"))
+	assert.NoError(t, err)
+	handler := BasicAuthMiddleware("restricted", htp)(okHandler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	r.SetBasicAuth("alice", "bar")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
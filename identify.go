@@ -0,0 +1,131 @@
+package htpasswd
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A Strength rates how well an encoded password resists guessing, should the htpasswd file
+// leak.
+type Strength int
+
+const (
+	StrengthUnknown Strength = iota
+	// StrengthInsecure is plain text.
+	StrengthInsecure
+	// StrengthWeak is a fast hash: sha, ssha, md5-crypt and apr1.
+	StrengthWeak
+	// StrengthModerate is crypt-sha with fewer than StrongCryptShaRounds rounds, or bcrypt
+	// with a cost below bcrypt.DefaultCost.
+	StrengthModerate
+	// StrengthStrong is bcrypt with at least bcrypt.DefaultCost, or crypt-sha with at least
+	// StrongCryptShaRounds rounds.
+	StrengthStrong
+)
+
+// StrongCryptShaRounds is the number of crypt-sha rounds rated StrengthStrong.
+const StrongCryptShaRounds = 100000
+
+func (s Strength) String() string {
+	switch s {
+	case StrengthInsecure:
+		return "insecure"
+	case StrengthWeak:
+		return "weak"
+	case StrengthModerate:
+		return "moderate"
+	case StrengthStrong:
+		return "strong"
+	}
+	return "unknown"
+}
+
+// HashInfo describes an encoded password.
+type HashInfo struct {
+	Algorithm Algorithm
+	// Variant is the prefix of the encoded password, like "$2y$", "$apr1$", "$1$", "$6$" or
+	// "{SSHA}". It is empty for plain text, or "{PLAIN}" if it has the nginx prefix.
+	Variant string
+	// Cost is the cost of bcrypt, 0 for the other algorithms.
+	Cost int
+	// Rounds are the rounds of crypt-sha, including the implicit DefaultCryptShaRounds,
+	// 0 for the other algorithms.
+	Rounds int
+	// SaltLength is the length of the salt in bytes, 0 for unsalted algorithms.
+	SaltLength int
+	Strength   Strength
+}
+
+// A HashDescriber is an EncodedPasswd which describes itself. Implement it in the
+// EncodedPasswd of a custom parser, so that its algorithm is reported by Authenticate,
+// Snapshot and Export, can be named in a RehashPolicy, and its HashInfo is returned by
+// Describe. The Algorithm of the HashInfo names the algorithm, e.g. "argon2id". If the
+// Strength is StrengthUnknown, it is rated like the builtin algorithm of that name, if any.
+type HashDescriber interface {
+	HashInfo() (HashInfo, error)
+}
+
+// Identify tells which of the builtin algorithms a password is encoded with, and with which
+// parameters. Anything without the prefix of a hash is plain text. An error is returned if
+// the encoded password has the prefix of an algorithm, but is malformed.
+func Identify(encoded string) (HashInfo, error) {
+	if encoded == "" {
+		return HashInfo{}, errors.New("empty encoded password")
+	}
+	for _, parse := range DefaultSystems {
+		ep, err := parse(encoded)
+		if err != nil {
+			return HashInfo{}, err
+		}
+		if ep != nil {
+			return Describe(ep)
+		}
+	}
+	return HashInfo{}, fmt.Errorf("unable to recognize encoded password %s", encoded)
+}
+
+// Describe returns the HashInfo of an encoded password of a builtin parser or of a
+// HashDescriber, and the zero HashInfo for any other.
+func Describe(ep EncodedPasswd) (HashInfo, error) {
+	var info HashInfo
+	var err error
+	switch d := ep.(type) {
+	case interface{ hashInfo() (HashInfo, error) }:
+		info, err = d.hashInfo()
+		info.Algorithm = algorithmOf(ep)
+	case HashDescriber:
+		info, err = d.HashInfo()
+	default:
+		return HashInfo{}, nil
+	}
+	if err != nil {
+		return HashInfo{}, err
+	}
+	if info.Strength == StrengthUnknown {
+		info.Strength = rate(info)
+	}
+	return info, nil
+}
+
+// rate returns the strength of an encoded password.
+func rate(info HashInfo) Strength {
+	switch info.Algorithm {
+	case AlgorithmPlain:
+		return StrengthInsecure
+	case AlgorithmSha, AlgorithmSsha, AlgorithmMd5Crypt, AlgorithmApr1:
+		return StrengthWeak
+	case AlgorithmCryptSha256, AlgorithmCryptSha512:
+		if info.Rounds >= StrongCryptShaRounds {
+			return StrengthStrong
+		}
+		return StrengthModerate
+	case AlgorithmBcrypt:
+		if info.Cost >= bcrypt.DefaultCost {
+			return StrengthStrong
+		}
+		return StrengthModerate
+	}
+	return StrengthUnknown
+}
@@ -0,0 +1,88 @@
+package htpasswd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentify(t *testing.T) {
+	for encoded, want := range map[string]HashInfo{
+		"bar":                               {Algorithm: AlgorithmPlain, Strength: StrengthInsecure},
+		"{PLAIN}bar":                        {Algorithm: AlgorithmPlain, Variant: "{PLAIN}", Strength: StrengthInsecure},
+		"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=": {Algorithm: AlgorithmSha, Variant: "{SHA}", Strength: StrengthWeak},
+		"{SSHA}/lLSOXpMWipWr3ifiighLCpqBiFoMzBM": {
+			Algorithm: AlgorithmSsha, Variant: "{SSHA}", SaltLength: 4, Strength: StrengthWeak,
+		},
+		"$apr1$VfoHyKyF$EQ3gDdg7EUQB69/ppHOOU0": {
+			Algorithm: AlgorithmApr1, Variant: "$apr1$", SaltLength: 8, Strength: StrengthWeak,
+		},
+		"$1$abcdefgh$hash": {Algorithm: AlgorithmMd5Crypt, Variant: "$1$", SaltLength: 8, Strength: StrengthWeak},
+		"$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O": {
+			Algorithm: AlgorithmBcrypt, Variant: "$2y$", Cost: 5, SaltLength: 16, Strength: StrengthModerate,
+		},
+		"$2b$12$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O": {
+			Algorithm: AlgorithmBcrypt, Variant: "$2b$", Cost: 12, SaltLength: 16, Strength: StrengthStrong,
+		},
+		"$5$saltstring$hash": {
+			Algorithm: AlgorithmCryptSha256, Variant: "$5$", Rounds: DefaultCryptShaRounds, SaltLength: 10,
+			Strength: StrengthModerate,
+		},
+		"$6$rounds=200000$saltstring$hash": {
+			Algorithm: AlgorithmCryptSha512, Variant: "$6$", Rounds: 200000, SaltLength: 10, Strength: StrengthStrong,
+		},
+	} {
+		info, err := Identify(encoded)
+		assert.NoError(t, err, encoded)
+		assert.Equal(t, want, info, encoded)
+	}
+
+	for _, encoded := range []string{"", "{SHA}broken", "$apr1$nosalt", "$2y$xx$broken", "$6$rounds=many$salt$hash"} {
+		_, err := Identify(encoded)
+		assert.Error(t, err, encoded)
+	}
+
+	assert.Equal(t, "strong", StrengthStrong.String())
+	assert.Equal(t, "unknown", Strength(42).String())
+}
+
+// argon2Password is a plain text password of a custom parser describing itself as argon2id.
+type argon2Password struct {
+	password string
+}
+
+func (a *argon2Password) MatchesPassword(pw string) bool {
+	return constantTimeEquals(pw, a.password)
+}
+
+func (a *argon2Password) HashInfo() (HashInfo, error) {
+	return HashInfo{Algorithm: "argon2id", Variant: "$argon2id$", SaltLength: 16, Strength: StrengthStrong}, nil
+}
+
+func TestHashDescriber(t *testing.T) {
+	parser := func(src string) (EncodedPasswd, error) {
+		if pw, ok := strings.CutPrefix(src, "$argon2id$"); ok {
+			return &argon2Password{pw}, nil
+		}
+		return nil, nil
+	}
+	htp, err := NewFromReader(strings.NewReader("alice:$argon2id$bar\n"), WithParsers(parser))
+	assert.NoError(t, err)
+
+	result, err := htp.Authenticate("alice", "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, Algorithm("argon2id"), result.Algorithm)
+	info, _ := htp.Snapshot().User("alice")
+	assert.Equal(t, StrengthStrong, info.Hash.Strength)
+	assert.True(t, RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}}.NeedsRehash(&argon2Password{}))
+
+	// builtin passwords are described without implementing HashDescriber
+	ep, _ := Sha("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=")
+	info.Hash, err = Describe(ep)
+	assert.NoError(t, err)
+	assert.Equal(t, HashInfo{Algorithm: AlgorithmSha, Variant: "{SHA}", Strength: StrengthWeak}, info.Hash)
+	info.Hash, err = Describe(&countingPassword{})
+	assert.NoError(t, err)
+	assert.Zero(t, info.Hash)
+}
@@ -0,0 +1,191 @@
+package htpasswd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// A Layer is one of the stores merged by a LayeredStore.
+type Layer struct {
+	// Name identifies the layer in conflicts and error messages.
+	Name  string
+	Store Store
+	// Deny makes the layer a deny list: its users are removed from the layers below it,
+	// whatever their encoded passwords. As the values are ignored, the lines of a deny list
+	// file may be just "username:".
+	Deny bool
+	// Static layers are loaded once, e.g. a file baked into an image, or again after
+	// LayeredStore.Invalidate. The other layers are loaded again on each Load.
+	Static bool
+}
+
+// A Conflict is a user provided by more than one layer.
+type Conflict struct {
+	Username string
+	// Layers are the names of the layers providing the user, from the lowest to the one
+	// which takes precedence.
+	Layers []string
+}
+
+// A LayeredStore is a Store merging the entries of several layers, e.g. a base file, a
+// per-environment file and a break-glass file. Later layers take precedence over earlier
+// ones: if a user is in more than one layer, the entry of the last one is used. Usernames
+// are compared in their normalized form, so "Alice" in a deny list removes "alice".
+type LayeredStore struct {
+	Layers []Layer
+	// OnConflict, if not nil, is called on each Load for every user provided by more than
+	// one layer. Deny layers don't cause conflicts.
+	OnConflict func(Conflict)
+	// Normalizers are applied to the usernames of the layers before they are merged. If
+	// nil, the normalizers given to WithUsernameNormalizers of the Htpasswd created by
+	// NewFromStore are used.
+	Normalizers []UsernameNormalizer
+
+	mu        sync.Mutex
+	inherited []UsernameNormalizer // of the Htpasswd, see Normalizers
+	loaded    []layerLoad          // of the last Load, by layer
+	origins   map[string]int       // by normalized username
+}
+
+type layerLoad struct {
+	entries []Entry
+	version string
+	ok      bool
+}
+
+// Load implements Store. It fails if any of the layers fails. The version changes whenever
+// the version of a layer changes, and is empty if any layer can't tell.
+func (s *LayeredStore) Load(ctx context.Context) ([]Entry, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded := make([]layerLoad, len(s.Layers))
+	for i, layer := range s.Layers {
+		if layer.Static && i < len(s.loaded) && s.loaded[i].ok {
+			loaded[i] = s.loaded[i]
+			continue
+		}
+		entries, version, err := layer.Store.Load(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load layer %s: %w", layer.Name, err)
+		}
+		loaded[i] = layerLoad{entries, version, true}
+	}
+
+	merged := make(map[string]Entry)
+	origins := make(map[string]int)
+	providers := make(map[string][]string)
+	var order []string
+	seen := make(map[string]bool)
+	for i, layer := range s.Layers {
+		for _, entry := range loaded[i].entries {
+			if entry.Source == "" {
+				entry.Source = layer.Name
+			}
+			key, err := s.normalize(entry.Username)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to load layer %s: %w", layer.Name, withSource(entry.Source, err))
+			}
+			if layer.Deny {
+				delete(merged, key)
+				delete(origins, key)
+				delete(providers, key)
+				continue
+			}
+			if !seen[key] {
+				seen[key] = true
+				order = append(order, key)
+			}
+			merged[key] = entry
+			origins[key] = i
+			providers[key] = append(providers[key], layer.Name)
+		}
+	}
+
+	entries := make([]Entry, 0, len(merged))
+	for _, key := range order {
+		entry, ok := merged[key]
+		if ok {
+			entries = append(entries, entry)
+		}
+		if layers := providers[key]; len(layers) > 1 && s.OnConflict != nil {
+			username := key
+			if ok {
+				username = entry.Username
+			}
+			s.OnConflict(Conflict{Username: username, Layers: layers})
+		}
+	}
+
+	s.loaded = loaded
+	s.origins = origins
+
+	return entries, layeredVersion(s.Layers, loaded), nil
+}
+
+// Invalidate makes the next Load load the layer of that name again, even if it is static.
+// To reload single layers, make all layers static and invalidate the ones which changed
+// before calling Htpasswd.Reload; the other layers keep the entries they had.
+func (s *LayeredStore) Invalidate(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, layer := range s.Layers {
+		if layer.Name == name {
+			if i < len(s.loaded) {
+				s.loaded[i].ok = false
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no layer %s", name)
+}
+
+// ReplaceEncoding implements ReplacingStore. The encoding is replaced in the layer which
+// provided the user on the last Load. If the store of that layer is not a ReplacingStore,
+// nothing is persisted.
+func (s *LayeredStore) ReplaceEncoding(ctx context.Context, username, oldEncoded, newEncoded string) error {
+	s.mu.Lock()
+	key, err := s.normalize(username)
+	i, ok := s.origins[key]
+	s.mu.Unlock()
+	if err != nil || !ok {
+		return fmt.Errorf("user %s is not in any layer", username)
+	}
+
+	store, ok := s.Layers[i].Store.(ReplacingStore)
+	if !ok {
+		return nil
+	}
+	return store.ReplaceEncoding(ctx, username, oldEncoded, newEncoded)
+}
+
+// inheritNormalizers sets the normalizers of the Htpasswd using the store.
+func (s *LayeredStore) inheritNormalizers(normalizers []UsernameNormalizer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inherited = normalizers
+}
+
+// normalize returns the key of a username. The mutex must be held.
+func (s *LayeredStore) normalize(username string) (string, error) {
+	if s.Normalizers != nil {
+		return normalizeUsername(s.Normalizers, username)
+	}
+	return normalizeUsername(s.inherited, username)
+}
+
+// layeredVersion combines the versions of the layers.
+func layeredVersion(layers []Layer, loaded []layerLoad) string {
+	h := sha256.New()
+	for i, l := range loaded {
+		if l.version == "" {
+			return ""
+		}
+		fmt.Fprintf(h, "%d:%s%d:%s", len(layers[i].Name), layers[i].Name, len(l.version), l.version)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
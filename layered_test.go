@@ -0,0 +1,197 @@
+package htpasswd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayeredStore(t *testing.T) {
+	var conflicts []Conflict
+	store := &LayeredStore{
+		Layers: []Layer{
+			{Name: "base", Store: MapStore{"alice": "bar", "bob": "bar", "carol": "bar"}},
+			{Name: "env", Store: BytesStore("bob:baz\ndave:bar\n")},
+			{Name: "deny", Store: BytesStore("carol:\ndave:\n"), Deny: true},
+			{Name: "break-glass", Store: MapStore{"dave": "qux"}},
+		},
+		OnConflict: func(c Conflict) { conflicts = append(conflicts, c) },
+	}
+
+	htp, err := NewFromStore(store)
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("bob", "baz"))
+	assert.False(t, htp.Match("bob", "bar"))
+	assert.False(t, htp.Match("carol", "bar"))
+	assert.True(t, htp.Match("dave", "qux"))
+
+	// dave of env is denied, so only break-glass provides him
+	assert.ElementsMatch(t, []Conflict{
+		{Username: "bob", Layers: []string{"base", "env"}},
+	}, conflicts)
+
+	// the source of an entry tells the layer
+	entries, _, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		if entry.Username == "alice" {
+			assert.Equal(t, "base", entry.Source)
+		}
+	}
+}
+
+func TestLayeredStoreReload(t *testing.T) {
+	base := &countingStore{Store: MapStore{"alice": "bar"}}
+	env := &countingStore{Store: MapStore{"bob": "bar"}}
+	store := &LayeredStore{Layers: []Layer{
+		{Name: "base", Store: base, Static: true},
+		{Name: "env", Store: env},
+	}}
+
+	htp, err := NewFromStore(store)
+	assert.NoError(t, err)
+	table := htp.passwds.Load()
+
+	// unchanged layers, the users are not parsed again
+	assert.NoError(t, htp.Reload())
+	assert.Same(t, table, htp.passwds.Load())
+
+	// static layers are loaded once
+	base.Store = MapStore{"alice": "baz"}
+	env.Store = MapStore{"bob": "baz"}
+	assert.NoError(t, htp.Reload())
+	assert.Equal(t, 1, base.loads)
+	assert.Equal(t, 3, env.loads)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("bob", "baz"))
+
+	// a failing layer fails the reload, the users are kept
+	env.Store = &FileStore{Path: filepath.Join(t.TempDir(), "missing")}
+	err = htp.Reload()
+	assert.ErrorContains(t, err, "failed to load layer env")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.True(t, htp.Match("bob", "baz"))
+}
+
+func TestLayeredStoreRehash(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	assert.NoError(t, os.WriteFile(envFile, []byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o640))
+
+	var rehashErr error
+	htp, err := NewFromStore(&LayeredStore{Layers: []Layer{
+		{Name: "base", Store: MapStore{"alice": "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="}},
+		{Name: "env", Store: &FileStore{Path: envFile}},
+	}}, WithRehash(
+		RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}},
+		BcryptEncoder(4),
+		func(_ string, err error) { rehashErr = err },
+	))
+	assert.NoError(t, err)
+
+	assert.True(t, htp.Match("bob", "password"))
+	assert.True(t, htp.Match("alice", "password"))
+	assert.NoError(t, rehashErr)
+
+	content, err := os.ReadFile(envFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "bob:$2a$04$")
+
+	// the layer of alice can't be written, so the rehash is kept in memory only
+	res, err := htp.Authenticate("alice", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmBcrypt, res.Algorithm)
+}
+
+func TestLayeredStoreNormalized(t *testing.T) {
+	var conflicts []Conflict
+	store := &LayeredStore{
+		Layers: []Layer{
+			{Name: "base", Store: MapStore{"alice": "bar", "bob": "bar"}},
+			{Name: "env", Store: MapStore{"Bob": "baz"}},
+			{Name: "deny", Store: BytesStore("Alice:\n"), Deny: true},
+		},
+		OnConflict: func(c Conflict) { conflicts = append(conflicts, c) },
+	}
+
+	// the normalizers of the Htpasswd are used
+	htp, err := NewFromStore(store, WithUsernameNormalizers(CaseFold))
+	assert.NoError(t, err)
+	assert.False(t, htp.Match("alice", "bar"))
+	assert.False(t, htp.Match("bob", "bar"))
+	assert.True(t, htp.Match("bob", "baz"))
+	assert.Equal(t, []string{"Bob"}, htp.Users())
+	assert.Equal(t, []Conflict{{Username: "Bob", Layers: []string{"base", "env"}}}, conflicts)
+
+	// set explicitly
+	store = &LayeredStore{
+		Layers: []Layer{
+			{Name: "base", Store: MapStore{"alice": "bar"}},
+			{Name: "deny", Store: BytesStore("ALICE:\n"), Deny: true},
+		},
+		Normalizers: []UsernameNormalizer{CaseFold},
+	}
+	entries, _, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = NewFromStore(&LayeredStore{Layers: []Layer{{Name: "base", Store: MapStore{"al ice": "bar"}}}},
+		WithUsernameNormalizers(PRECISUsername))
+	assert.ErrorContains(t, err, "failed to load layer base")
+}
+
+func TestLayeredStoreDenyConflict(t *testing.T) {
+	var conflicts []Conflict
+	htp, err := NewFromStore(&LayeredStore{
+		Layers: []Layer{
+			{Name: "base", Store: MapStore{"alice": "bar"}},
+			{Name: "env", Store: MapStore{"alice": "baz"}},
+			{Name: "deny", Store: BytesStore("alice:\n"), Deny: true},
+			{Name: "break-glass", Store: MapStore{"bob": "qux"}},
+		},
+		OnConflict: func(c Conflict) { conflicts = append(conflicts, c) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, htp.Users())
+	assert.Empty(t, conflicts)
+
+	// a user denied and provided again is listed once
+	entries, _, err := (&LayeredStore{Layers: []Layer{
+		{Name: "base", Store: MapStore{"alice": "bar"}},
+		{Name: "deny", Store: BytesStore("alice:\n"), Deny: true},
+		{Name: "break-glass", Store: MapStore{"alice": "qux"}},
+	}}).Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{{Username: "alice", Value: "qux", Source: "break-glass"}}, entries)
+}
+
+func TestLayeredStoreInvalidate(t *testing.T) {
+	base := &countingStore{Store: MapStore{"alice": "bar"}}
+	env := &countingStore{Store: MapStore{"bob": "bar"}}
+	store := &LayeredStore{Layers: []Layer{
+		{Name: "base", Store: base, Static: true},
+		{Name: "env", Store: env, Static: true},
+	}}
+	htp, err := NewFromStore(store)
+	assert.NoError(t, err)
+
+	// only the invalidated layer is loaded again
+	base.Store = MapStore{"alice": "baz"}
+	env.Store = MapStore{"bob": "baz"}
+	assert.NoError(t, store.Invalidate("env"))
+	assert.NoError(t, htp.Reload())
+	assert.Equal(t, 1, base.loads)
+	assert.Equal(t, 2, env.loads)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("bob", "baz"))
+
+	assert.NoError(t, htp.Reload())
+	assert.Equal(t, 2, env.loads)
+
+	assert.EqualError(t, store.Invalidate("missing"), "no layer missing")
+}
@@ -0,0 +1,199 @@
+package htpasswd
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"strings"
+)
+
+// LDIFOptions configures ExportLDIF. Empty fields have the defaults given.
+type LDIFOptions struct {
+	// BaseDN is the DN below which the users and groups are, e.g. "dc=example,dc=com".
+	BaseDN string
+	// UsersRDN is the container of the users below BaseDN, "ou=people" by default.
+	UsersRDN string
+	// GroupsRDN is the container of the groups below BaseDN, "ou=groups" by default.
+	GroupsRDN string
+	// Attributes maps the user record to LDAP attributes.
+	Attributes LDIFAttributes
+}
+
+// LDIFAttributes are the names of the LDAP attributes of the user record. Empty names have
+// the defaults given.
+type LDIFAttributes struct {
+	// Username is the naming attribute of users, "uid" by default.
+	Username string
+	// DisplayName is "cn" by default. The username is used for users without display name,
+	// as cn is required by inetOrgPerson.
+	DisplayName string
+	Email       string // "mail" by default
+	Comment     string // "description" by default
+}
+
+// An UnrepresentableUser is a user whose password can't be exported to LDAP. The user is
+// exported without password.
+type UnrepresentableUser struct {
+	Username  string
+	Algorithm Algorithm
+}
+
+// ldapScheme maps the algorithms to their userPassword scheme. {CRYPT} relies on the
+// crypt(3) of the directory server supporting the hash.
+var ldapScheme = map[Algorithm]string{
+	AlgorithmSha:         "",
+	AlgorithmSsha:        "",
+	AlgorithmMd5Crypt:    "{CRYPT}",
+	AlgorithmBcrypt:      "{CRYPT}",
+	AlgorithmCryptSha256: "{CRYPT}",
+	AlgorithmCryptSha512: "{CRYPT}",
+}
+
+// ExportLDIF writes the users of htp as inetOrgPerson entries and the groups of groups,
+// which may be nil, as groupOfNames entries to w in LDIF. The passwords are exported as
+// userPassword in {SHA}, {SSHA} or {CRYPT} form. Users with other algorithms, namely apr1
+// and plain text, are exported without password and returned. Disabled users are exported
+// without password as well.
+func ExportLDIF(w io.Writer, htp *Htpasswd, groups *HTGroup, opts LDIFOptions) ([]UnrepresentableUser, error) {
+	opts = opts.withDefaults()
+	bw := bufio.NewWriter(w)
+	ldif := &ldifWriter{w: bw}
+	ldif.line("version: 1")
+
+	var unrepresentable []UnrepresentableUser
+	for _, u := range Export(htp, nil) {
+		ldif.line("")
+		ldif.attr("dn", opts.userDN(u.Username))
+		for _, class := range []string{"top", "person", "organizationalPerson", "inetOrgPerson"} {
+			ldif.attr("objectClass", class)
+		}
+		ldif.attr(opts.Attributes.Username, u.Username)
+		cn := u.DisplayName
+		if cn == "" {
+			cn = u.Username
+		}
+		ldif.attr(opts.Attributes.DisplayName, cn)
+		if opts.Attributes.DisplayName != "cn" {
+			ldif.attr("cn", cn)
+		}
+		// sn is required by person
+		ldif.attr("sn", cn[strings.LastIndex(cn, " ")+1:])
+		if u.Email != "" {
+			ldif.attr(opts.Attributes.Email, u.Email)
+		}
+		if u.Comment != "" {
+			ldif.attr(opts.Attributes.Comment, u.Comment)
+		}
+
+		scheme, ok := ldapScheme[u.Algorithm]
+		switch {
+		case u.Disabled || u.Password == "":
+		case ok:
+			ldif.attr("userPassword", scheme+u.Password)
+		default:
+			unrepresentable = append(unrepresentable, UnrepresentableUser{u.Username, u.Algorithm})
+		}
+	}
+
+	if groups != nil {
+		for _, name := range groups.Groups() {
+			ldif.line("")
+			ldif.attr("dn", "cn="+escapeDNValue(name)+","+opts.GroupsRDN+","+opts.BaseDN)
+			ldif.attr("objectClass", "top")
+			ldif.attr("objectClass", "groupOfNames")
+			ldif.attr("cn", name)
+			for _, member := range groups.Members(name) {
+				ldif.attr("member", opts.userDN(member))
+			}
+		}
+	}
+
+	if ldif.err != nil {
+		return nil, ldif.err
+	}
+	return unrepresentable, bw.Flush()
+}
+
+func (o LDIFOptions) withDefaults() LDIFOptions {
+	for _, d := range []struct {
+		field *string
+		value string
+	}{
+		{&o.UsersRDN, "ou=people"},
+		{&o.GroupsRDN, "ou=groups"},
+		{&o.Attributes.Username, "uid"},
+		{&o.Attributes.DisplayName, "cn"},
+		{&o.Attributes.Email, "mail"},
+		{&o.Attributes.Comment, "description"},
+	} {
+		if *d.field == "" {
+			*d.field = d.value
+		}
+	}
+	return o
+}
+
+func (o LDIFOptions) userDN(username string) string {
+	return o.Attributes.Username + "=" + escapeDNValue(username) + "," + o.UsersRDN + "," + o.BaseDN
+}
+
+// escapeDNValue escapes an attribute value for a DN, see RFC 4514.
+func escapeDNValue(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`"+,;<>\`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(value)-1 && r == ' ':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ldifWriter writes LDIF lines, keeping the first error.
+type ldifWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (l *ldifWriter) line(s string) {
+	if l.err == nil {
+		_, l.err = io.WriteString(l.w, s+"\n")
+	}
+}
+
+// attr writes an attribute, base64 encoded if the value is not a safe string, and folded
+// at 76 columns.
+func (l *ldifWriter) attr(name, value string) {
+	s := name + ": " + value
+	if !safeLDIFString(value) {
+		s = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	for len(s) > 76 {
+		l.line(s[:76])
+		s = " " + s[76:]
+	}
+	l.line(s)
+}
+
+// safeLDIFString reports whether the value can be written as is, see SAFE-STRING in RFC 2849.
+func safeLDIFString(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.ContainsAny(value[:1], " :<") || strings.HasSuffix(value, " ") {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c > 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package htpasswd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportLDIF(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader(`alice:{SSHA}/lLSOXpMWipWr3ifiighLCpqBiFoMzBM:Alice Liddell:alice@example.com
+bob:$apr1$VfoHyKyF$EQ3gDdg7EUQB69/ppHOOU0
+carol:$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O:::::Café, Inc.
+dave:!{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+`), WithUserFields(FieldDisplayName, FieldEmail, FieldIgnore, FieldIgnore, FieldComment), WithDisabledPrefix("!"))
+	assert.NoError(t, err)
+	groups, err := NewHTGroupsFromReader(strings.NewReader("admins: alice\nusers: carol alice\n"))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	unrepresentable, err := ExportLDIF(&buf, htp, groups, LDIFOptions{BaseDN: "dc=example,dc=com"})
+	assert.NoError(t, err)
+	assert.Equal(t, []UnrepresentableUser{{"bob", AlgorithmApr1}}, unrepresentable)
+	assert.Equal(t, `version: 1
+
+dn: uid=alice,ou=people,dc=example,dc=com
+objectClass: top
+objectClass: person
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: alice
+cn: Alice Liddell
+sn: Liddell
+mail: alice@example.com
+userPassword: {SSHA}/lLSOXpMWipWr3ifiighLCpqBiFoMzBM
+
+dn: uid=bob,ou=people,dc=example,dc=com
+objectClass: top
+objectClass: person
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: bob
+cn: bob
+sn: bob
+
+dn: uid=carol,ou=people,dc=example,dc=com
+objectClass: top
+objectClass: person
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: carol
+cn: carol
+sn: carol
+description:: Q2Fmw6ksIEluYy4=
+userPassword: {CRYPT}$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5Fe
+ YJQ6O
+
+dn: uid=dave,ou=people,dc=example,dc=com
+objectClass: top
+objectClass: person
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: dave
+cn: dave
+sn: dave
+
+dn: cn=admins,ou=groups,dc=example,dc=com
+objectClass: top
+objectClass: groupOfNames
+cn: admins
+member: uid=alice,ou=people,dc=example,dc=com
+
+dn: cn=users,ou=groups,dc=example,dc=com
+objectClass: top
+objectClass: groupOfNames
+cn: users
+member: uid=alice,ou=people,dc=example,dc=com
+member: uid=carol,ou=people,dc=example,dc=com
+`, buf.String())
+}
+
+func TestExportLDIFAttributes(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("a,b:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=:Bob:bob@example.com\n"),
+		WithUserFields(FieldDisplayName, FieldEmail))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = ExportLDIF(&buf, htp, nil, LDIFOptions{
+		BaseDN:     "o=test",
+		UsersRDN:   "ou=staff",
+		Attributes: LDIFAttributes{Username: "cn", DisplayName: "displayName", Email: "email"},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `dn: cn=a\,b,ou=staff,o=test
+objectClass: top
+objectClass: person
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+cn: a,b
+displayName: Bob
+cn: Bob
+sn: Bob
+email: bob@example.com
+userPassword: {SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+`)
+}
+
+func TestEscapeDNValue(t *testing.T) {
+	for value, escaped := range map[string]string{
+		"bob":   "bob",
+		"a,b+c": `a\,b\+c`,
+		" #x ":  `\ #x\ `,
+		"#x":    `\#x`,
+		`"<;>\`: `\"\<\;\>\\`,
+		"café":  "café",
+	} {
+		assert.Equal(t, escaped, escapeDNValue(value), value)
+	}
+}
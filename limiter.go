@@ -0,0 +1,60 @@
+package htpasswd
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBusy is returned by Authenticate if too many password checks are waiting already.
+var ErrBusy = errors.New("too many concurrent password checks")
+
+// WithMaxConcurrentChecks limits the number of password checks running at the same time to
+// limit. Checks of bcrypt or crypt-sha with many rounds are expensive, so a burst of logins
+// could otherwise keep all CPUs busy.
+//
+// queue is the number of checks which may wait for a free slot, until the context given to
+// MatchContext or AuthenticateContext is done; Match and Authenticate wait as long as it
+// takes. Any further check fails with ErrBusy right away, as does every check which finds
+// no free slot if queue is 0. A limit below 1 is taken as 1, a negative queue as 0.
+func WithMaxConcurrentChecks(limit, queue int) Option {
+	return func(p *parameters) {
+		p.limiter = &limiter{
+			slots:   make(chan struct{}, max(limit, 1)),
+			waiting: make(chan struct{}, max(queue, 0)),
+		}
+	}
+}
+
+// limiter is a semaphore with a bounded queue.
+type limiter struct {
+	slots   chan struct{}
+	waiting chan struct{}
+}
+
+// acquire takes a slot, waiting for one if necessary until ctx is done.
+func (l *limiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	select {
+	case l.waiting <- struct{}{}:
+	default:
+		return ErrBusy
+	}
+	defer func() { <-l.waiting }()
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release returns a slot taken by acquire.
+func (l *limiter) release() {
+	<-l.slots
+}
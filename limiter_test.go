@@ -0,0 +1,59 @@
+package htpasswd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{slots: make(chan struct{}, 1), waiting: make(chan struct{}, 1)}
+	assert.NoError(t, l.acquire(context.Background()))
+
+	acquired := make(chan error)
+	go func() { acquired <- l.acquire(context.Background()) }()
+
+	// wait for the goroutine to queue up
+	for len(l.waiting) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.ErrorIs(t, l.acquire(context.Background()), ErrBusy)
+
+	l.release()
+	assert.NoError(t, <-acquired)
+	assert.Len(t, l.waiting, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.acquire(ctx), context.DeadlineExceeded)
+	assert.Len(t, l.waiting, 0)
+}
+
+func TestMaxConcurrentChecks(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"), WithMaxConcurrentChecks(1, 0))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "bar"))
+
+	assert.NoError(t, htp.limiter.acquire(context.Background()))
+	_, err = htp.Authenticate("alice", "bar")
+	assert.ErrorIs(t, err, ErrBusy)
+	assert.False(t, htp.Match("alice", "bar"))
+
+	// without a dummy password there is nothing to check for unknown users
+	_, err = htp.Authenticate("nobody", "bar")
+	assert.ErrorIs(t, err, ErrUnknownUser)
+
+	htp.limiter.release()
+	assert.True(t, htp.Match("alice", "bar"))
+}
+
+func TestMaxConcurrentChecksClamped(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"), WithMaxConcurrentChecks(0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cap(htp.limiter.slots))
+	assert.Equal(t, 0, cap(htp.limiter.waiting))
+	assert.True(t, htp.Match("alice", "bar"))
+}
@@ -0,0 +1,148 @@
+package htpasswd
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by Authenticate for an account locked after too many failed attempts.
+var ErrLocked = errors.New("account locked")
+
+// WithLockout locks an account after maxFailures failed attempts within window. A locked
+// account is refused by Match without checking the password. It is unlocked automatically
+// after cooldown, or by Unlock. If cooldown is 0, only Unlock unlocks the account.
+//
+// Failed attempts are only counted for existing users. With WithConstantTimeUnknownUsers,
+// the password given for a locked account is checked against the dummy password, like the
+// one of an unknown user.
+func WithLockout(maxFailures int, window, cooldown time.Duration) Option {
+	return func(p *parameters) {
+		p.lockout = &lockout{
+			maxFailures: maxFailures,
+			window:      window,
+			cooldown:    cooldown,
+			users:       make(map[string]*lockoutState),
+		}
+	}
+}
+
+// A LockoutStatus describes the lockout state of an account.
+type LockoutStatus struct {
+	Locked bool
+	// LockedUntil is the time the account is unlocked automatically. It is the zero time
+	// if the account is not locked or is locked until Unlock.
+	LockedUntil time.Time
+	// Failures is the number of failed attempts within the window.
+	Failures int
+}
+
+type lockout struct {
+	maxFailures int
+	window      time.Duration
+	cooldown    time.Duration
+
+	mu    sync.Mutex
+	users map[string]*lockoutState
+}
+
+type lockoutState struct {
+	failures []time.Time
+	locked   bool
+	lockedAt time.Time
+}
+
+// status returns the lockout status of the user with the key at time now.
+func (l *lockout) status(key string, now time.Time) LockoutStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.users[key]
+	if !ok {
+		return LockoutStatus{}
+	}
+	l.expire(key, state, now)
+
+	status := LockoutStatus{Locked: state.locked, Failures: len(state.failures)}
+	if state.locked && l.cooldown > 0 {
+		status.LockedUntil = state.lockedAt.Add(l.cooldown)
+	}
+	return status
+}
+
+// fail records a failed attempt.
+func (l *lockout) fail(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.users[key]
+	if ok {
+		l.expire(key, state, now)
+		if state.locked {
+			return
+		}
+	}
+	state, ok = l.users[key]
+	if !ok {
+		state = &lockoutState{}
+		l.users[key] = state
+	}
+
+	state.failures = append(state.failures, now)
+	if len(state.failures) >= l.maxFailures {
+		state.failures = nil
+		state.locked = true
+		state.lockedAt = now
+	}
+}
+
+// reset forgets the failed attempts and unlocks the account.
+func (l *lockout) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.users, key)
+}
+
+// expire forgets failures outside of the window and ends the lock after the cooldown.
+func (l *lockout) expire(key string, state *lockoutState, now time.Time) {
+	if state.locked && l.cooldown > 0 && !now.Before(state.lockedAt.Add(l.cooldown)) {
+		state.locked = false
+	}
+
+	recent := state.failures[:0]
+	for _, failure := range state.failures {
+		if now.Sub(failure) < l.window {
+			recent = append(recent, failure)
+		}
+	}
+	state.failures = recent
+
+	if !state.locked && len(state.failures) == 0 {
+		delete(l.users, key)
+	}
+}
+
+// Locked reports whether the account of the user is locked. It is always false without
+// WithLockout.
+func (bf *Htpasswd) Locked(username string) bool {
+	return bf.LockoutStatus(username).Locked
+}
+
+// LockoutStatus returns the lockout status of the account of the user.
+func (bf *Htpasswd) LockoutStatus(username string) LockoutStatus {
+	key, err := normalizeUsername(bf.normalizers, username)
+	if bf.lockout == nil || err != nil {
+		return LockoutStatus{}
+	}
+	return bf.lockout.status(key, bf.now())
+}
+
+// Unlock unlocks the account of the user and forgets its failed attempts.
+func (bf *Htpasswd) Unlock(username string) {
+	key, err := normalizeUsername(bf.normalizers, username)
+	if bf.lockout == nil || err != nil {
+		return
+	}
+	bf.lockout.reset(key)
+}
@@ -0,0 +1,97 @@
+package htpasswd
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	htp, err := NewFromReader(
+		strings.NewReader("alice:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\nbob:bar\n"),
+		WithLockout(3, time.Minute, 10*time.Minute),
+		WithClock(func() time.Time { return now }),
+	)
+	assert.NoError(t, err)
+
+	// failures outside of the window do not count
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.Equal(t, LockoutStatus{Failures: 2}, htp.LockoutStatus("alice"))
+	now = now.Add(time.Minute)
+	assert.Equal(t, LockoutStatus{}, htp.LockoutStatus("alice"))
+
+	// a success resets the failures
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.Equal(t, LockoutStatus{}, htp.LockoutStatus("alice"))
+
+	for i := 0; i < 3; i++ {
+		_, err = htp.Authenticate("alice", "wrong")
+		assert.ErrorIs(t, err, ErrBadPassword)
+	}
+	assert.True(t, htp.Locked("alice"))
+	assert.Equal(t, LockoutStatus{Locked: true, LockedUntil: now.Add(10 * time.Minute)}, htp.LockoutStatus("alice"))
+	_, err = htp.Authenticate("alice", "bar")
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.False(t, htp.Match("alice", "bar"))
+	assert.False(t, htp.Locked("bob"))
+	assert.True(t, htp.Match("bob", "bar"))
+
+	now = now.Add(10 * time.Minute)
+	assert.False(t, htp.Locked("alice"))
+	assert.True(t, htp.Match("alice", "bar"))
+
+	// unknown users are not tracked
+	for i := 0; i < 3; i++ {
+		assert.False(t, htp.Match("nobody", "wrong"))
+	}
+	assert.False(t, htp.Locked("nobody"))
+}
+
+func TestLockoutUnlock(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"), WithLockout(1, time.Minute, 0))
+	assert.NoError(t, err)
+
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.Equal(t, LockoutStatus{Locked: true}, htp.LockoutStatus("alice"))
+	assert.False(t, htp.Match("alice", "bar"))
+
+	htp.Unlock("alice")
+	assert.False(t, htp.Locked("alice"))
+	assert.True(t, htp.Match("alice", "bar"))
+
+	// without lockout nothing is ever locked
+	htp, err = NewFromReader(strings.NewReader("alice:bar\n"))
+	assert.NoError(t, err)
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.False(t, htp.Locked("alice"))
+	htp.Unlock("alice")
+}
+
+func TestLockoutConstantTime(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("alice:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"),
+		WithLockout(1, time.Minute, 0), WithConstantTimeUnknownUsers())
+	assert.NoError(t, err)
+
+	var checks atomic.Int32
+	var dummy EncodedPasswd = &countingPassword{"dummy", &checks}
+	htp.dummy.Store(&dummy)
+
+	assert.False(t, htp.Match("alice", "wrong"))
+	assert.True(t, htp.Locked("alice"))
+	assert.Equal(t, int32(0), checks.Load())
+
+	// a locked account takes as long as an unknown user
+	_, err = htp.Authenticate("alice", "bar")
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.Equal(t, int32(1), checks.Load())
+	_, err = htp.Authenticate("nobody", "bar")
+	assert.ErrorIs(t, err, ErrUnknownUser)
+	assert.Equal(t, int32(2), checks.Load())
+}
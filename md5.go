@@ -156,3 +156,14 @@ func (m *md5Password) MatchesPassword(pw string) bool {
 	hashed := md5Crypt(pw, m.salt, m.prefix)
 	return constantTimeEquals(hashed, m.hashed)
 }
+
+func (m *md5Password) algorithm() Algorithm {
+	if m.prefix == PrefixCryptMd5 {
+		return AlgorithmMd5Crypt
+	}
+	return AlgorithmApr1
+}
+
+func (m *md5Password) hashInfo() (HashInfo, error) {
+	return HashInfo{Variant: m.prefix, SaltLength: len(m.salt)}, nil
+}
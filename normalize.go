@@ -0,0 +1,65 @@
+package htpasswd
+
+import (
+	"fmt"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/secure/precis"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A UsernameNormalizer maps a username to the canonical form used as lookup key.
+//
+// Normalizers are applied to the usernames of the password file when it is loaded and
+// to the username given to Match, so both sides are compared in the same form. If the
+// username cannot be normalized, return an error. A file entry which fails to normalize
+// is an error when loading, a username which fails to normalize never matches.
+type UsernameNormalizer func(username string) (string, error)
+
+// CaseFold folds the username using Unicode full case folding, so "Alice" and "ALICE" are
+// the same user.
+func CaseFold(username string) (string, error) {
+	return cases.Fold().String(username), nil
+}
+
+// NFC converts the username to Unicode Normalization Form C.
+func NFC(username string) (string, error) {
+	return norm.NFC.String(username), nil
+}
+
+// PRECISUsername enforces the UsernameCasePreserved profile of RFC 8265.
+func PRECISUsername(username string) (string, error) {
+	normalized, err := precis.UsernameCasePreserved.String(username)
+	if err != nil {
+		return "", fmt.Errorf("invalid username %q: %w", username, err)
+	}
+	return normalized, nil
+}
+
+// PRECISUsernameCaseMapped enforces the UsernameCaseMapped profile of RFC 8265, which
+// lower cases the username in addition to PRECISUsername.
+func PRECISUsernameCaseMapped(username string) (string, error) {
+	normalized, err := precis.UsernameCaseMapped.String(username)
+	if err != nil {
+		return "", fmt.Errorf("invalid username %q: %w", username, err)
+	}
+	return normalized, nil
+}
+
+// Normalize returns the username in the canonical form of the normalizers given to
+// WithUsernameNormalizers, which identifies the user. Without normalizers it is the
+// username as is.
+func (bf *Htpasswd) Normalize(username string) (string, error) {
+	return normalizeUsername(bf.normalizers, username)
+}
+
+// normalizeUsername applies the normalizers in order.
+func normalizeUsername(normalizers []UsernameNormalizer, username string) (string, error) {
+	for _, n := range normalizers {
+		var err error
+		if username, err = n(username); err != nil {
+			return "", err
+		}
+	}
+	return username, nil
+}
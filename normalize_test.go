@@ -0,0 +1,43 @@
+package htpasswd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsernameNormalizers(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("Alice:secret\n"), WithUsernameNormalizers(CaseFold))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "secret"))
+	assert.True(t, htp.Match("ALICE", "secret"))
+	assert.False(t, htp.Match("alice", "SECRET"))
+
+	// "é" precomposed in the file, decomposed at match time
+	htp, err = NewFromReader(strings.NewReader("jos\u00e9:secret\n"), WithUsernameNormalizers(NFC))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("jose\u0301", "secret"))
+
+	htp, err = NewFromReader(strings.NewReader("jos\u00e9:secret\n"))
+	assert.NoError(t, err)
+	assert.False(t, htp.Match("jose\u0301", "secret"))
+
+	htp, err = NewFromReader(strings.NewReader("Jos\u00e9:secret\n"), WithUsernameNormalizers(PRECISUsernameCaseMapped))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("JOSE\u0301", "secret"))
+	assert.False(t, htp.Match("jos\u00e9 ", "secret"))
+}
+
+func TestUsernameNormalizerConflict(t *testing.T) {
+	_, err := NewFromReader(strings.NewReader("alice:one\nAlice:two\n"), WithUsernameNormalizers(CaseFold))
+	assert.Error(t, err)
+
+	// the same user twice is not a conflict, the last one wins
+	htp, err := NewFromReader(strings.NewReader("alice:one\nalice:two\n"), WithUsernameNormalizers(CaseFold))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("Alice", "two"))
+
+	_, err = NewFromReader(strings.NewReader("al ice:one\n"), WithUsernameNormalizers(PRECISUsername))
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package htpasswd
 
 import (
 	"fmt"
+	"strings"
 )
 
 type plainPassword struct {
@@ -26,3 +27,14 @@ func (p *plainPassword) MatchesPassword(pw string) bool {
 	//         in their password. It's a big planet.
 	return constantTimeEquals(pw, p.password) || constantTimeEquals("{PLAIN}"+pw, p.password)
 }
+
+func (p *plainPassword) algorithm() Algorithm {
+	return AlgorithmPlain
+}
+
+func (p *plainPassword) hashInfo() (HashInfo, error) {
+	if strings.HasPrefix(p.password, "{PLAIN}") {
+		return HashInfo{Variant: "{PLAIN}"}, nil
+	}
+	return HashInfo{}, nil
+}
@@ -0,0 +1,210 @@
+package htpasswd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A RehashPolicy decides which encoded passwords are too weak and should be replaced.
+type RehashPolicy struct {
+	// Algorithms are the accepted algorithms. Passwords encoded with any other algorithm
+	// need a rehash. If empty, all algorithms are accepted.
+	Algorithms []Algorithm
+	// MinBcryptCost is the lowest accepted bcrypt cost.
+	MinBcryptCost int
+	// MinCryptShaRounds is the lowest accepted number of crypt-sha rounds. Remember that
+	// crypt-sha without the rounds component has DefaultCryptShaRounds.
+	MinCryptShaRounds int
+}
+
+// NeedsRehash reports whether the encoded password falls short of the policy.
+func (p RehashPolicy) NeedsRehash(ep EncodedPasswd) bool {
+	if len(p.Algorithms) > 0 && !slices.Contains(p.Algorithms, algorithmOf(ep)) {
+		return true
+	}
+
+	switch e := ep.(type) {
+	case *bcryptPassword:
+		cost, err := bcrypt.Cost(e.hashed)
+		return err != nil || cost < p.MinBcryptCost
+	case *cryptPassword:
+		return e.roundCount() < p.MinCryptShaRounds
+	}
+	return false
+}
+
+// rehash is the configuration of WithRehash.
+type rehash struct {
+	policy  RehashPolicy
+	encode  PasswdEncoder
+	onError func(username string, err error)
+}
+
+// WithRehash migrates users to a stronger hashing system as they log in. After a successful
+// Match of a password whose encoding needs a rehash according to policy, the password is
+// encoded anew with encode, and the htpasswd file is rewritten with the new encoding. If
+// the Htpasswd was not created from a file or a ReplacingStore, only the in-memory entry is
+// replaced.
+//
+// The rehash happens synchronously within Match, so the first login of a user after
+// enabling it takes a little longer. Errors do not affect the outcome of Match, they are
+// reported to onError, if not nil. An encoding by encode which still needs a rehash
+// according to policy is reported as error and not stored.
+func WithRehash(policy RehashPolicy, encode PasswdEncoder, onError func(username string, err error)) Option {
+	return func(p *parameters) {
+		p.rehash = &rehash{policy, encode, onError}
+	}
+}
+
+// maybeRehash replaces the encoded password of a user who has just been authenticated with
+// password, if the rehash policy asks for it.
+func (bf *Htpasswd) maybeRehash(key string, entry *passwdEntry, password string) {
+	if bf.rehash == nil || !bf.rehash.policy.NeedsRehash(entry.matcher) {
+		return
+	}
+
+	if err := bf.replaceEncoding(key, entry, password); err != nil && bf.rehash.onError != nil {
+		bf.rehash.onError(entry.user.Name, err)
+	}
+}
+
+func (bf *Htpasswd) replaceEncoding(key string, entry *passwdEntry, password string) error {
+	bf.rehashMu.Lock()
+	defer bf.rehashMu.Unlock()
+
+	// Users of a LookupStore are not in the table, the store has to notice concurrent
+	// rehashes by the old encoding.
+	_, lookedUp := bf.store.(LookupStore)
+	if current, ok := (*bf.passwds.Load())[key]; current != entry && (ok || !lookedUp) {
+		// rehashed by a concurrent login, or changed by a reload meanwhile
+		return nil
+	}
+
+	encoded, err := bf.rehash.encode(password)
+	if err != nil {
+		return fmt.Errorf("failed to encode password of %s: %w", entry.user.Name, err)
+	}
+	matcher, err := bf.parse(entry.user.Name, encoded)
+	if err != nil {
+		return err
+	}
+	if bf.rehash.policy.NeedsRehash(matcher) {
+		// persisting it would rehash the password again on every login
+		return fmt.Errorf("new encoding of the password of %s falls short of the rehash policy", entry.user.Name)
+	}
+
+	if store, ok := bf.store.(ReplacingStore); ok {
+		if err := store.ReplaceEncoding(context.Background(), entry.user.Name, entry.encoded, encoded); err != nil {
+			return err
+		}
+	}
+
+	old := bf.passwds.Load()
+	if (*old)[key] != entry {
+		// the entry was changed by a reload meanwhile
+		return nil
+	}
+	newPasswdMap := make(passwdTable, len(*old))
+	for k, v := range *old {
+		newPasswdMap[k] = v
+	}
+	newPasswdMap[key] = &passwdEntry{user: entry.user, encoded: encoded, matcher: matcher}
+
+	// the new encoding may be stronger than the dummy password
+	var dummy EncodedPasswd
+	if bf.constantTime {
+		if dummy, err = bf.makeDummy(newPasswdMap); err != nil {
+			return err
+		}
+	}
+	if bf.passwds.CompareAndSwap(old, &newPasswdMap) && bf.constantTime {
+		bf.dummy.Store(&dummy)
+	}
+
+	return nil
+}
+
+// replaceInFile replaces the encoded password of user in the htpasswd file protected by
+// prot, provided that it is still oldEncoded. The file is replaced atomically.
+func replaceInFile(path string, prot protection, user, oldEncoded, newEncoded string) error {
+	if prot.publicKey != nil {
+		return fmt.Errorf("signed htpasswd file %s can't be rewritten", path)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read htpasswd file %s: %w", path, err)
+	}
+	content, err := prot.open(raw, path, nil)
+	if err != nil {
+		return err
+	}
+
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	replaced := false
+	for i, rawLine := range lines {
+		line := strings.TrimSpace(string(rawLine))
+		if !strings.HasPrefix(line, user+":") {
+			continue
+		}
+		encoding := strings.TrimPrefix(line, user+":")
+		if !strings.HasPrefix(encoding, oldEncoded) {
+			continue
+		}
+		rest := strings.TrimPrefix(encoding, oldEncoded)
+		if rest != "" && !strings.HasPrefix(rest, ":") {
+			continue
+		}
+
+		newLine := user + ":" + newEncoded + rest
+		if bytes.HasSuffix(rawLine, []byte("\n")) {
+			newLine += "\n"
+		}
+		lines[i] = []byte(newLine)
+		replaced = true
+	}
+	if !replaced {
+		return fmt.Errorf("password of %s has changed in htpasswd file %s", user, path)
+	}
+
+	content, err = encryptContent(bytes.Join(lines, nil), prot.key)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content)
+}
+
+// writeFileAtomic replaces the file at path by a file with content, keeping its permissions.
+func writeFileAtomic(path string, content []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write htpasswd file %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write htpasswd file %s: %w", path, err)
+	}
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,179 @@
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRehashPolicy(t *testing.T) {
+	policy := RehashPolicy{
+		Algorithms:        []Algorithm{AlgorithmBcrypt, AlgorithmCryptSha512},
+		MinBcryptCost:     6,
+		MinCryptShaRounds: 10000,
+	}
+
+	for encoded, needsRehash := range map[string]bool{
+		"$apr1$VfoHyKyF$EQ3gDdg7EUQB69/ppHOOU0":                                                                                       true,
+		"{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=":                                                                                           true,
+		"$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O":                                                                true,
+		"$2b$08$hQbZuw.cHsECArUAP9mOjehaJxTG9NMJfioQIHcbC0YyXpVybhoQa":                                                                false,
+		"$6$98765432101234567890$FPU3HtJ9RcPVUvxifkIJ/AlrBxWLqJQvyxK2f8x4qDX/A1RpcIvgjToU5erVkR6XUl7qwPsm7idpbMH5f/pBn0":              true,
+		"$6$rounds=10000$98765432101234567890$FPU3HtJ9RcPVUvxifkIJ/AlrBxWLqJQvyxK2f8x4qDX/A1RpcIvgjToU5erVkR6XUl7qwPsm7idpbMH5f/pBn0": false,
+	} {
+		ep, err := CryptSha(encoded)
+		if ep == nil {
+			ep, err = Md5(encoded)
+		}
+		if ep == nil {
+			ep, err = Sha(encoded)
+		}
+		if ep == nil {
+			ep, err = Bcrypt(encoded)
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, needsRehash, policy.NeedsRehash(ep), encoded)
+	}
+
+	// the zero policy accepts everything
+	ep, _ := Plain("bar")
+	assert.False(t, RehashPolicy{}.NeedsRehash(ep))
+}
+
+func TestRehashFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	contents := "# users\nalice:$apr1$VfoHyKyF$EQ3gDdg7EUQB69/ppHOOU0:Alice\nbob:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"
+	assert.NoError(t, os.WriteFile(filename, []byte(contents), 0o640))
+
+	var rehashErrors []error
+	htp, err := New(
+		filename,
+		WithUserFields(FieldDisplayName),
+		WithRehash(
+			RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}},
+			BcryptEncoder(5),
+			func(username string, err error) { rehashErrors = append(rehashErrors, err) },
+		),
+	)
+	assert.NoError(t, err)
+
+	// a failed login does not rehash
+	assert.False(t, htp.Match("alice", "wrong"))
+	result, err := htp.Authenticate("alice", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmApr1, result.Algorithm)
+	assert.Empty(t, rehashErrors)
+
+	result, err = htp.Authenticate("alice", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmBcrypt, result.Algorithm)
+
+	written, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	lines := strings.Split(string(written), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "# users", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "alice:$2a$05$"), lines[1])
+	assert.True(t, strings.HasSuffix(lines[1], ":Alice"), lines[1])
+	assert.Equal(t, "bob:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=", lines[2])
+
+	info, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	assert.NoError(t, htp.Reload())
+	assert.True(t, htp.Match("alice", "password"))
+	alice, _ := htp.User("alice")
+	assert.Equal(t, "Alice", alice.DisplayName)
+
+	// the file was changed behind our back
+	assert.NoError(t, os.WriteFile(filename, []byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o640))
+	assert.True(t, htp.Match("bob", "bar"))
+	assert.Len(t, rehashErrors, 1)
+}
+
+func TestRehashReader(t *testing.T) {
+	htp, err := NewFromReader(
+		strings.NewReader("bob:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"),
+		WithRehash(RehashPolicy{Algorithms: []Algorithm{AlgorithmCryptSha512}}, CryptSha512Encoder(6000), nil),
+	)
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+
+	result, err := htp.Authenticate("bob", "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmCryptSha512, result.Algorithm)
+}
+
+func TestRehashEncoderBelowPolicy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	contents := "bob:$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O\n"
+	assert.NoError(t, os.WriteFile(filename, []byte(contents), 0o640))
+
+	var rehashErrors []error
+	htp, err := New(filename, WithRehash(RehashPolicy{MinBcryptCost: 12}, BcryptEncoder(6),
+		func(username string, err error) { rehashErrors = append(rehashErrors, err) }))
+	assert.NoError(t, err)
+
+	assert.True(t, htp.Match("bob", "bar"))
+	assert.EqualError(t, rehashErrors[0], "new encoding of the password of bob falls short of the rehash policy")
+
+	// the file is not rewritten
+	written, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, contents, string(written))
+	result, err := htp.Authenticate("bob", "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmBcrypt, result.Algorithm)
+}
+
+func TestRehashDummy(t *testing.T) {
+	htp, err := NewFromReader(
+		strings.NewReader("bob:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"),
+		WithConstantTimeUnknownUsers(),
+		WithRehash(RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}}, BcryptEncoder(6), nil),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmSha, algorithmOf(*htp.dummy.Load()))
+
+	// unknown users take as long as bob with his new encoding
+	assert.True(t, htp.Match("bob", "bar"))
+	dummy := (*htp.dummy.Load()).(*bcryptPassword)
+	cost, err := bcrypt.Cost(dummy.hashed)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, cost)
+}
+
+func TestRehashConcurrent(t *testing.T) {
+	var encodes atomic.Int32
+	var rehashErrors atomic.Int32
+	encode := func(pw string) (string, error) {
+		encodes.Add(1)
+		return BcryptEncoder(4)(pw)
+	}
+	htp, err := NewFromReader(
+		strings.NewReader("bob:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n"),
+		WithRehash(RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}}, encode,
+			func(string, error) { rehashErrors.Add(1) }),
+	)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, htp.Match("bob", "bar"))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), encodes.Load())
+	assert.Zero(t, rehashErrors.Load())
+}
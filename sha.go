@@ -41,3 +41,11 @@ func (s *shaPassword) MatchesPassword(pw string) bool {
 	h := sha1.Sum([]byte(pw))
 	return subtle.ConstantTimeCompare(h[:], s.hashed) == 1
 }
+
+func (s *shaPassword) algorithm() Algorithm {
+	return AlgorithmSha
+}
+
+func (s *shaPassword) hashInfo() (HashInfo, error) {
+	return HashInfo{Variant: "{SHA}"}, nil
+}
@@ -0,0 +1,126 @@
+package htpasswd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// signaturePrefix starts the trailing line of a signed htpasswd or group file. It is a
+// comment, so signed files are still valid files.
+const signaturePrefix = "#htpasswd-signature:ed25519:"
+
+// SignatureSuffix is appended to the name of a file to get the name of its detached
+// signature file.
+const SignatureSuffix = ".sig"
+
+var (
+	// ErrUnsigned is returned when a public key is given but a file is not signed.
+	ErrUnsigned = errors.New("not signed")
+	// ErrBadSignature is returned when the signature of a file doesn't match.
+	ErrBadSignature = errors.New("bad signature")
+)
+
+// WithPublicKey verifies the ed25519 signature of the htpasswd file read by New, NewFromFS,
+// NewFromGlob or NewFromReader with key. Reload refuses unsigned files and files with a bad
+// signature, and keeps the users it has. The signature is either the last line of the file,
+// as added by Sign, or in a detached signature file named like the file with
+// SignatureSuffix, as written by DetachedSignature. Encrypted files are signed after
+// encryption.
+//
+// Signed files can't be rewritten by WithRehash, as the private key is not at hand.
+//
+// Stores given to NewFromStore have their own key, see FileStore; NewFromStore, NewFromEnv
+// and NewFromSecretDir refuse this option.
+func WithPublicKey(key ed25519.PublicKey) Option {
+	return func(p *parameters) {
+		p.publicKey = key
+	}
+}
+
+// Sign returns content with a trailing signature line made with key.
+func Sign(key ed25519.PrivateKey, content []byte) []byte {
+	signed := bytes.Clone(content)
+	if len(signed) > 0 && !bytes.HasSuffix(signed, []byte("\n")) {
+		signed = append(signed, '\n')
+	}
+	signature := ed25519.Sign(key, signed)
+	signed = append(signed, signaturePrefix...)
+	signed = base64.StdEncoding.AppendEncode(signed, signature)
+	return append(signed, '\n')
+}
+
+// DetachedSignature returns the content of a detached signature file of content made with
+// key.
+func DetachedSignature(key ed25519.PrivateKey, content []byte) []byte {
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, content))
+	return []byte(signature + "\n")
+}
+
+// Verify checks the signature of content with key. The signature is the trailing line of
+// content, or else detached, which may be nil. It returns content without the signature
+// line. A key which is not an ed25519 public key is an error.
+func Verify(key ed25519.PublicKey, content, detached []byte) ([]byte, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key of %d bytes", len(key))
+	}
+	body, line := splitSignature(content)
+	var encoded []byte
+	switch {
+	case line != nil:
+		encoded = line
+	case detached != nil:
+		encoded = bytes.TrimSpace(detached)
+	default:
+		return nil, ErrUnsigned
+	}
+
+	signature, err := base64.StdEncoding.AppendDecode(nil, encoded)
+	if err != nil || !ed25519.Verify(key, body, signature) {
+		return nil, ErrBadSignature
+	}
+	return body, nil
+}
+
+// splitSignature splits the trailing signature line, if any, off content.
+func splitSignature(content []byte) ([]byte, []byte) {
+	trimmed := bytes.TrimRight(content, "\r\n")
+	i := bytes.LastIndexByte(trimmed, '\n') + 1
+	line, ok := bytes.CutPrefix(trimmed[i:], []byte(signaturePrefix))
+	if !ok {
+		return content, nil
+	}
+	return content[:i], line
+}
+
+// protection is how the content of a file is protected: encrypted with key and signed for
+// publicKey, if not nil.
+type protection struct {
+	key       []byte
+	publicKey ed25519.PublicKey
+}
+
+// open verifies and decrypts the content of the file name. readDetached reads the detached
+// signature file, it may be nil.
+func (p protection) open(content []byte, name string, readDetached func() ([]byte, error)) ([]byte, error) {
+	if p.publicKey != nil {
+		var detached []byte
+		var err error
+		if readDetached != nil {
+			detached, err = readDetached()
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to read signature of %s: %w", name, err)
+			}
+		}
+
+		content, err = Verify(p.publicKey, content, detached)
+		if err != nil {
+			return nil, withSource(name, err)
+		}
+	}
+
+	return decryptContent(content, p.key, name)
+}
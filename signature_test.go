@@ -0,0 +1,202 @@
+package htpasswd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	return public, private
+}
+
+func TestSignVerify(t *testing.T) {
+	public, private := testSigningKey(t)
+	otherPublic, _ := testSigningKey(t)
+	content := []byte("bob:bar\n")
+
+	signed := Sign(private, content)
+	assert.True(t, bytes.HasPrefix(signed, content))
+	body, err := Verify(public, signed, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, content, body)
+
+	// a missing newline is added before the signature
+	body, err = Verify(public, Sign(private, []byte("bob:bar")), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, content, body)
+
+	_, err = Verify(otherPublic, signed, nil)
+	assert.ErrorIs(t, err, ErrBadSignature)
+
+	tampered := append([]byte("mallory:bar\n"), signed...)
+	_, err = Verify(public, tampered, nil)
+	assert.ErrorIs(t, err, ErrBadSignature)
+
+	detached := DetachedSignature(private, content)
+	body, err = Verify(public, content, detached)
+	assert.NoError(t, err)
+	assert.Equal(t, content, body)
+	_, err = Verify(public, []byte("mallory:bar\n"), detached)
+	assert.ErrorIs(t, err, ErrBadSignature)
+
+	_, err = Verify(public, content, nil)
+	assert.ErrorIs(t, err, ErrUnsigned)
+}
+
+func TestSignedFiles(t *testing.T) {
+	public, private := testSigningKey(t)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "htpasswd")
+	assert.NoError(t, os.WriteFile(filename, Sign(private, []byte("bob:bar\n")), 0o640))
+
+	htp, err := New(filename, WithPublicKey(public))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+
+	// the signed file is a valid file without verification, too
+	htp2, err := New(filename)
+	assert.NoError(t, err)
+	assert.True(t, htp2.Match("bob", "bar"))
+
+	// a tampered file is refused by Reload, the users are kept
+	tampered := append([]byte("mallory:bar\n"), Sign(private, []byte("bob:bar\n"))...)
+	assert.NoError(t, os.WriteFile(filename, tampered, 0o640))
+	assert.EqualError(t, htp.Reload(), filename+": bad signature")
+	assert.False(t, htp.Match("mallory", "bar"))
+	assert.True(t, htp.Match("bob", "bar"))
+
+	assert.NoError(t, os.WriteFile(filename, []byte("mallory:bar\n"), 0o640))
+	assert.EqualError(t, htp.Reload(), filename+": not signed")
+	assert.False(t, htp.Match("mallory", "bar"))
+
+	// detached signature
+	assert.NoError(t, os.WriteFile(filename+SignatureSuffix, DetachedSignature(private, []byte("mallory:bar\n")), 0o640))
+	assert.NoError(t, htp.Reload())
+	assert.True(t, htp.Match("mallory", "bar"))
+
+	fsys := fstest.MapFS{
+		"htpasswd":     {Data: []byte("bob:bar\n")},
+		"htpasswd.sig": {Data: DetachedSignature(private, []byte("bob:bar\n"))},
+	}
+	htp, err = NewFromFS(fsys, "htpasswd", WithPublicKey(public))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+
+	_, err = NewFromReader(strings.NewReader("bob:bar\n"), WithPublicKey(public))
+	assert.ErrorIs(t, err, ErrUnsigned)
+	htp, err = NewFromReader(bytes.NewReader(Sign(private, []byte("bob:bar\n"))), WithPublicKey(public))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+}
+
+func TestSignedFileShortKey(t *testing.T) {
+	_, private := testSigningKey(t)
+	short := ed25519.PublicKey("short")
+	signed := Sign(private, []byte("bob:bar\n"))
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, os.WriteFile(filename, signed, 0o640))
+
+	_, err := Verify(short, signed, nil)
+	assert.EqualError(t, err, "invalid ed25519 public key of 5 bytes")
+	_, err = New(filename, WithPublicKey(short))
+	assert.EqualError(t, err, filename+": invalid ed25519 public key of 5 bytes")
+	_, err = NewFromStore(&FileStore{Path: filename, PublicKey: short})
+	assert.Error(t, err)
+	_, err = NewHTGroup(filename, WithGroupPublicKey(short))
+	assert.Error(t, err)
+}
+
+func TestSignedEncryptedFile(t *testing.T) {
+	public, private := testSigningKey(t)
+	encrypted, err := Encrypt(testKey, []byte("bob:bar\n"))
+	assert.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, os.WriteFile(filename, Sign(private, encrypted), 0o640))
+
+	htp, err := New(filename, WithEncryptionKey(testKey), WithPublicKey(public))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "bar"))
+}
+
+func TestSignedGlob(t *testing.T) {
+	public, private := testSigningKey(t)
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "alice"), Sign(private, []byte("alice:bar\n")), 0o640))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bob"), []byte("bob:bar\n"), 0o640))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bob.sig"), DetachedSignature(private, []byte("bob:bar\n")), 0o640))
+
+	htp, err := NewFromGlob(filepath.Join(dir, "*"), WithPublicKey(public))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("bob", "bar"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "mallory"), []byte("mallory:bar\n"), 0o640))
+	assert.EqualError(t, htp.Reload(), filepath.Join(dir, "mallory")+": not signed")
+}
+
+func TestSignedStore(t *testing.T) {
+	public, _ := testSigningKey(t)
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, os.WriteFile(filename, []byte("evil:bar\n"), 0o640))
+
+	// the keys of stores are not replaced by the options
+	_, err := NewFromStore(&FileStore{Path: filename}, WithPublicKey(public))
+	assert.ErrorContains(t, err, "WithPublicKey can't be applied to a store")
+	_, err = NewFromStore(&FileStore{Path: filename}, WithEncryptionKey(testKey))
+	assert.ErrorContains(t, err, "WithEncryptionKey can't be applied to a store")
+	_, err = NewFromEnv("HTPASSWD_USER_", WithPublicKey(public))
+	assert.Error(t, err)
+	_, err = NewFromSecretDir(t.TempDir(), WithPublicKey(public))
+	assert.Error(t, err)
+
+	_, err = NewFromStore(&FileStore{Path: filename, PublicKey: public})
+	assert.EqualError(t, err, filename+": not signed")
+}
+
+func TestSignedRehash(t *testing.T) {
+	public, private := testSigningKey(t)
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	signed := Sign(private, []byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+	assert.NoError(t, os.WriteFile(filename, signed, 0o640))
+
+	var rehashErr error
+	htp, err := New(filename, WithPublicKey(public), WithRehash(
+		RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}},
+		BcryptEncoder(4),
+		func(_ string, err error) { rehashErr = err },
+	))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("bob", "password"))
+	assert.EqualError(t, rehashErr, "signed htpasswd file "+filename+" can't be rewritten")
+
+	content, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, signed, content)
+}
+
+func TestSignedGroups(t *testing.T) {
+	public, private := testSigningKey(t)
+	filename := filepath.Join(t.TempDir(), "groups")
+	assert.NoError(t, os.WriteFile(filename, Sign(private, []byte(contents)), 0o640))
+
+	htGroup, err := NewHTGroup(filename, WithGroupPublicKey(public))
+	assert.NoError(t, err)
+	assert.True(t, htGroup.IsUserInGroup("user1", "admins"))
+
+	assert.NoError(t, os.WriteFile(filename, []byte(contents2), 0o640))
+	assert.EqualError(t, htGroup.Reload(), filename+": not signed")
+	assert.False(t, htGroup.IsUserInGroup("user2", "admins"))
+
+	assert.NoError(t, os.WriteFile(filename+SignatureSuffix, DetachedSignature(private, []byte(contents2)), 0o640))
+	assert.NoError(t, htGroup.Reload())
+	assert.True(t, htGroup.IsUserInGroup("user2", "admins"))
+}
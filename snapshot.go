@@ -0,0 +1,105 @@
+package htpasswd
+
+import (
+	"context"
+	"sort"
+)
+
+// A UserInfo describes a user of a Snapshot.
+type UserInfo struct {
+	User
+	// Algorithm is the hashing system of the password, AlgorithmUnknown for a disabled
+	// account without password or a password of a custom parser which is no HashDescriber.
+	Algorithm Algorithm
+	// Hash describes the password, it is zero for AlgorithmUnknown or malformed parameters.
+	Hash HashInfo
+}
+
+// A Snapshot is an immutable view of the users of a Htpasswd at one point in time. It is
+// not affected by later reloads or rehashes.
+type Snapshot struct {
+	table       passwdTable
+	normalizers []UsernameNormalizer
+}
+
+// Snapshot returns the users loaded by the last reload. Users of a LookupStore, which are
+// only looked up on demand, are not part of it.
+func (bf *Htpasswd) Snapshot() *Snapshot {
+	return &Snapshot{table: *bf.passwds.Load(), normalizers: bf.normalizers}
+}
+
+// Users returns the names of the users loaded by the last reload, as written in the
+// password file and sorted.
+func (bf *Htpasswd) Users() []string {
+	return bf.Snapshot().Users()
+}
+
+// Len returns the number of users loaded by the last reload.
+func (bf *Htpasswd) Len() int {
+	return len(*bf.passwds.Load())
+}
+
+// HasUser reports whether there is a user of that name, regardless whether the account is
+// disabled or expired. Users of a LookupStore are looked up, an unavailable store counts
+// as no such user.
+func (bf *Htpasswd) HasUser(username string) bool {
+	_, _, ok, _ := bf.lookup(context.Background(), username)
+	return ok
+}
+
+// Users returns the names of the users, as written in the password file and sorted.
+func (s *Snapshot) Users() []string {
+	users := make([]string, 0, len(s.table))
+	for _, entry := range s.table {
+		users = append(users, entry.user.Name)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Len returns the number of users.
+func (s *Snapshot) Len() int {
+	return len(s.table)
+}
+
+// HasUser reports whether there is a user of that name.
+func (s *Snapshot) HasUser(username string) bool {
+	_, ok := s.entry(username)
+	return ok
+}
+
+// User returns the description of a user.
+func (s *Snapshot) User(username string) (UserInfo, bool) {
+	entry, ok := s.entry(username)
+	if !ok {
+		return UserInfo{}, false
+	}
+	return entry.info(), true
+}
+
+// All returns the descriptions of all users, sorted by name.
+func (s *Snapshot) All() []UserInfo {
+	infos := make([]UserInfo, 0, len(s.table))
+	for _, entry := range s.table {
+		infos = append(infos, entry.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func (s *Snapshot) entry(username string) (*passwdEntry, bool) {
+	key, err := normalizeUsername(s.normalizers, username)
+	if err != nil {
+		return nil, false
+	}
+	entry, ok := s.table[key]
+	return entry, ok
+}
+
+func (e *passwdEntry) info() UserInfo {
+	info := UserInfo{User: e.user.clone(), Algorithm: algorithmOf(e.matcher)}
+	if e.matcher != nil {
+		info.Hash, _ = Describe(e.matcher)
+	}
+	return info
+}
@@ -0,0 +1,57 @@
+package htpasswd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader(`carol:!
+Bob:$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O:Bob Builder
+alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+`), WithUserFields(FieldDisplayName), WithDisabledPrefix("!"), WithUsernameNormalizers(CaseFold))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"Bob", "alice", "carol"}, htp.Users())
+	assert.Equal(t, 3, htp.Len())
+	assert.True(t, htp.HasUser("bob"))
+	assert.True(t, htp.HasUser("carol"))
+	assert.False(t, htp.HasUser("dave"))
+
+	snapshot := htp.Snapshot()
+	assert.NoError(t, htp.ReloadFromReader(strings.NewReader("dave:bar\n")))
+	assert.Equal(t, []string{"dave"}, htp.Users())
+
+	// the snapshot is not affected by the reload
+	assert.Equal(t, 3, snapshot.Len())
+	assert.Equal(t, []string{"Bob", "alice", "carol"}, snapshot.Users())
+	assert.True(t, snapshot.HasUser("BOB"))
+	assert.False(t, snapshot.HasUser("dave"))
+
+	info, ok := snapshot.User("bob")
+	assert.True(t, ok)
+	assert.Equal(t, "Bob", info.Name)
+	assert.Equal(t, "Bob Builder", info.DisplayName)
+	assert.Equal(t, AlgorithmBcrypt, info.Algorithm)
+	assert.Equal(t, 5, info.Hash.Cost)
+	_, ok = snapshot.User("dave")
+	assert.False(t, ok)
+
+	all := snapshot.All()
+	assert.Len(t, all, 3)
+	for i, want := range []struct {
+		name      string
+		algorithm Algorithm
+		disabled  bool
+	}{
+		{"Bob", AlgorithmBcrypt, false},
+		{"alice", AlgorithmSha, false},
+		{"carol", AlgorithmUnknown, true},
+	} {
+		assert.Equal(t, want.name, all[i].Name)
+		assert.Equal(t, want.algorithm, all[i].Algorithm, want.name)
+		assert.Equal(t, want.disabled, all[i].Disabled, want.name)
+	}
+}
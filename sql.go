@@ -0,0 +1,145 @@
+package htpasswd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// An SQLStore is a LookupStore with the users in a database table. The encoded passwords are
+// parsed like the lines of an htpasswd file, so they may have the disabled prefix and user
+// fields as well. Without LoadQuery, WithConstantTimeUnknownUsers needs WithDummyPassword.
+type SQLStore struct {
+	DB *sql.DB
+	// LookupQuery selects the encoded password of the user given as the only argument, e.g.
+	// "SELECT hash FROM users WHERE name = ?". A NULL encoded password is an unknown user.
+	LookupQuery string
+	// LoadQuery optionally selects the username and the encoded password of all users, which
+	// are then loaded by Reload like an htpasswd file. Leave it empty to look up every user.
+	LoadQuery string
+	// UpdateQuery optionally replaces the encoded password, for WithRehash. Its arguments are
+	// the new encoded password, the username and the old encoded password, e.g.
+	// "UPDATE users SET hash = ? WHERE name = ? AND hash = ?". The encoded passwords are
+	// without the disabled prefix and user fields.
+	UpdateQuery string
+	// CacheTTL is how long users who were found are cached, to save queries on every Match.
+	// Zero disables the cache. Unknown users are not cached.
+	CacheTTL time.Duration
+
+	now   func() time.Time // nil for time.Now
+	mu    sync.Mutex
+	cache map[string]cachedEntry
+	adds  int // additions to the cache since the last sweep
+}
+
+type cachedEntry struct {
+	entry   Entry
+	expires time.Time
+}
+
+// Load implements Store. It returns no entries if there is no LoadQuery.
+func (s *SQLStore) Load(ctx context.Context) ([]Entry, string, error) {
+	s.mu.Lock()
+	s.cache = nil
+	s.mu.Unlock()
+
+	if s.LoadQuery == "" {
+		return nil, "", nil
+	}
+
+	rows, err := s.DB.QueryContext(ctx, s.LoadQuery)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load users from database: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var username string
+		var value sql.NullString
+		if err := rows.Scan(&username, &value); err != nil {
+			return nil, "", fmt.Errorf("failed to load users from database: %w", err)
+		}
+		if value.Valid {
+			entries = append(entries, Entry{Username: username, Value: value.String, Source: "database"})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to load users from database: %w", err)
+	}
+
+	return entries, entriesVersion(entries), nil
+}
+
+// Lookup implements LookupStore.
+func (s *SQLStore) Lookup(ctx context.Context, username string) (Entry, bool, error) {
+	now := s.clock()
+	if s.CacheTTL > 0 {
+		s.mu.Lock()
+		cached, ok := s.cache[username]
+		s.mu.Unlock()
+		if ok && now.Before(cached.expires) {
+			return cached.entry, true, nil
+		}
+	}
+
+	var value sql.NullString
+	err := s.DB.QueryRowContext(ctx, s.LookupQuery, username).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !value.Valid) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to look up user %s in database: %w", username, err)
+	}
+	entry := Entry{Username: username, Value: value.String, Source: "database"}
+
+	if s.CacheTTL > 0 {
+		s.mu.Lock()
+		if s.cache == nil {
+			s.cache = make(map[string]cachedEntry)
+		}
+		s.adds++
+		if s.adds >= sweepInterval {
+			s.adds = 0
+			for k, c := range s.cache {
+				if !now.Before(c.expires) {
+					delete(s.cache, k)
+				}
+			}
+		}
+		s.cache[username] = cachedEntry{entry, now.Add(s.CacheTTL)}
+		s.mu.Unlock()
+	}
+
+	return entry, true, nil
+}
+
+// ReplaceEncoding implements ReplacingStore. Without an UpdateQuery nothing is persisted.
+func (s *SQLStore) ReplaceEncoding(ctx context.Context, username, oldEncoded, newEncoded string) error {
+	if s.UpdateQuery == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	delete(s.cache, username)
+	s.mu.Unlock()
+
+	res, err := s.DB.ExecContext(ctx, s.UpdateQuery, newEncoded, username, oldEncoded)
+	if err != nil {
+		return fmt.Errorf("failed to update password of %s in database: %w", username, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("password of %s has changed in database", username)
+	}
+	return nil
+}
+
+func (s *SQLStore) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
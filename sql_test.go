@@ -0,0 +1,244 @@
+package htpasswd
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testLookupQuery = "SELECT hash FROM users WHERE name = ?"
+	testLoadQuery   = "SELECT name, hash FROM users"
+	testUpdateQuery = "UPDATE users SET hash = ? WHERE name = ? AND hash = ?"
+)
+
+// fakeDB is an in-process database/sql driver with a users table, which knows only the
+// test queries.
+type fakeDB struct {
+	mu      sync.Mutex
+	users   map[string]string
+	queries int
+	err     error
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.queries++
+	if s.query != testUpdateQuery {
+		return nil, fmt.Errorf("unknown query %s", s.query)
+	}
+	name := args[1].(string)
+	if hash, ok := s.db.users[name]; !ok || hash != args[2].(string) {
+		return driver.RowsAffected(0), nil
+	}
+	s.db.users[name] = args[0].(string)
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.queries++
+	if s.db.err != nil {
+		return nil, s.db.err
+	}
+	rows := &fakeRows{}
+	switch s.query {
+	case testLookupQuery:
+		rows.columns = []string{"hash"}
+		if hash, ok := s.db.users[args[0].(string)]; ok {
+			rows.values = [][]driver.Value{{hash}}
+		}
+	case testLoadQuery:
+		rows.columns = []string{"name", "hash"}
+		for name, hash := range s.db.users {
+			rows.values = append(rows.values, []driver.Value{name, hash})
+		}
+		sort.Slice(rows.values, func(i, j int) bool {
+			return rows.values[i][0].(string) < rows.values[j][0].(string)
+		})
+	default:
+		return nil, fmt.Errorf("unknown query %s", s.query)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func newFakeDB(users map[string]string) (*fakeDB, *sql.DB) {
+	db := &fakeDB{users: users}
+	return db, sql.OpenDB(db)
+}
+
+func TestSQLStoreLookup(t *testing.T) {
+	db, sqlDB := newFakeDB(map[string]string{
+		"alice": "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		"bob":   "!bar",
+	})
+	defer sqlDB.Close()
+
+	htp, err := NewFromStore(&SQLStore{DB: sqlDB, LookupQuery: testLookupQuery}, WithDisabledPrefix("!"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, db.queries)
+
+	assert.True(t, htp.Match("alice", "password"))
+	assert.False(t, htp.Match("alice", "bar"))
+	_, err = htp.Authenticate("bob", "bar")
+	assert.ErrorIs(t, err, ErrDisabled)
+	_, err = htp.Authenticate("carol", "bar")
+	assert.ErrorIs(t, err, ErrUnknownUser)
+	assert.Equal(t, 4, db.queries)
+
+	// a failing database is not a bad password
+	db.err = errors.New("connection refused")
+	_, err = htp.Authenticate("alice", "password")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.NotErrorIs(t, err, ErrBadCredentials)
+
+	w := serveBasicAuth(BasicAuthMiddleware("test", htp)(okHandler), "alice", "password")
+	assert.Equal(t, 503, w.Code)
+}
+
+func TestSQLStoreConstantTime(t *testing.T) {
+	_, sqlDB := newFakeDB(map[string]string{"alice": "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="})
+	defer sqlDB.Close()
+	store := &SQLStore{DB: sqlDB, LookupQuery: testLookupQuery}
+
+	// nothing is loaded to make up the dummy password from
+	_, err := NewFromStore(store, WithConstantTimeUnknownUsers())
+	assert.ErrorContains(t, err, "needs WithDummyPassword")
+
+	_, err = NewFromStore(store, WithConstantTimeUnknownUsers(), WithDummyPassword("bar"), WithParsers(Bcrypt))
+	assert.ErrorContains(t, err, "invalid dummy password")
+
+	htp, err := NewFromStore(store, WithConstantTimeUnknownUsers(),
+		WithDummyPassword("$2b$08$hQbZuw.cHsECArUAP9mOjehaJxTG9NMJfioQIHcbC0YyXpVybhoQa"))
+	assert.NoError(t, err)
+	dummy := htp.dummy.Load()
+	assert.Equal(t, AlgorithmBcrypt, algorithmOf(*dummy))
+	assert.True(t, htp.Match("alice", "password"))
+	assert.False(t, htp.Match("carol", "bar"))
+}
+
+func TestSQLStoreLoad(t *testing.T) {
+	db, sqlDB := newFakeDB(map[string]string{"alice": "bar"})
+	defer sqlDB.Close()
+
+	htp, err := NewFromStore(&SQLStore{DB: sqlDB, LookupQuery: testLookupQuery, LoadQuery: testLoadQuery})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, db.queries)
+	table := htp.passwds.Load()
+
+	// loaded users are not looked up
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.Equal(t, 1, db.queries)
+
+	// users added since are looked up
+	db.users["bob"] = "bar"
+	assert.True(t, htp.Match("bob", "bar"))
+	assert.Equal(t, 2, db.queries)
+
+	// unchanged tables are not parsed again
+	delete(db.users, "bob")
+	assert.NoError(t, htp.Reload())
+	assert.Same(t, table, htp.passwds.Load())
+
+	db.users["alice"] = "baz"
+	assert.NoError(t, htp.Reload())
+	assert.True(t, htp.Match("alice", "baz"))
+}
+
+func TestSQLStoreCache(t *testing.T) {
+	db, sqlDB := newFakeDB(map[string]string{"alice": "bar"})
+	defer sqlDB.Close()
+
+	now := time.Unix(1700000000, 0)
+	store := &SQLStore{DB: sqlDB, LookupQuery: testLookupQuery, CacheTTL: time.Minute}
+	store.now = func() time.Time { return now }
+	htp, err := NewFromStore(store)
+	assert.NoError(t, err)
+
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.True(t, htp.Match("alice", "bar"))
+	assert.False(t, htp.Match("bob", "bar"))
+	assert.False(t, htp.Match("bob", "bar"))
+	assert.Equal(t, 3, db.queries)
+
+	db.users["alice"] = "baz"
+	assert.True(t, htp.Match("alice", "bar"))
+	now = now.Add(time.Minute)
+	assert.True(t, htp.Match("alice", "baz"))
+	assert.Equal(t, 4, db.queries)
+
+	// Reload empties the cache
+	db.users["alice"] = "qux"
+	assert.NoError(t, htp.Reload())
+	assert.True(t, htp.Match("alice", "qux"))
+}
+
+func TestSQLStoreRehash(t *testing.T) {
+	db, sqlDB := newFakeDB(map[string]string{"alice": "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="})
+	defer sqlDB.Close()
+
+	var rehashErr error
+	htp, err := NewFromStore(
+		&SQLStore{DB: sqlDB, LookupQuery: testLookupQuery, UpdateQuery: testUpdateQuery, CacheTTL: time.Minute},
+		WithRehash(RehashPolicy{Algorithms: []Algorithm{AlgorithmBcrypt}}, BcryptEncoder(4),
+			func(_ string, err error) { rehashErr = err }),
+	)
+	assert.NoError(t, err)
+
+	assert.True(t, htp.Match("alice", "password"))
+	assert.NoError(t, rehashErr)
+	assert.True(t, strings.HasPrefix(db.users["alice"], "$2a$04$"))
+
+	res, err := htp.Authenticate("alice", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmBcrypt, res.Algorithm)
+}
@@ -49,3 +49,11 @@ func (s *sshaPassword) MatchesPassword(password string) bool {
 	hash := sha1.Sum(sha)
 	return subtle.ConstantTimeCompare(hash[:], s.hashed) == 1
 }
+
+func (s *sshaPassword) algorithm() Algorithm {
+	return AlgorithmSsha
+}
+
+func (s *sshaPassword) hashInfo() (HashInfo, error) {
+	return HashInfo{Variant: "{SSHA}", SaltLength: len(s.salt)}, nil
+}
@@ -0,0 +1,196 @@
+package htpasswd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// An Entry is a user as provided by a Store.
+type Entry struct {
+	Username string
+	// Value is everything following the username in an htpasswd file: the encoded password,
+	// possibly with the disabled prefix and the user fields.
+	Value string
+	// Source tells where the entry comes from, e.g. the file name and line number. It is
+	// used in error messages and may be empty.
+	Source string
+}
+
+// A Store provides the users of an Htpasswd. The entries are parsed by the Htpasswd, so the
+// parsers and options apply regardless of the Store.
+type Store interface {
+	// Load returns all entries, and a version which changes whenever the entries change.
+	// If the version didn't change since the last Load, Reload doesn't parse the entries
+	// again. An empty version means the Store can't tell.
+	Load(ctx context.Context) ([]Entry, string, error)
+}
+
+// A LookupStore is a Store which can look up single users, e.g. in a database. Users who
+// were not returned by Load are looked up on each Match, so Load may return no entries at all.
+type LookupStore interface {
+	Store
+
+	// Lookup returns the entry of the user with the normalized username, if any.
+	Lookup(ctx context.Context, username string) (Entry, bool, error)
+}
+
+// ErrUnavailable is returned by Authenticate if a LookupStore fails.
+var ErrUnavailable = errors.New("user store unavailable")
+
+// A ReplacingStore is a Store which can replace the encoded password of a user. WithRehash
+// persists new encodings to it.
+type ReplacingStore interface {
+	Store
+
+	// ReplaceEncoding replaces the encoded password of the user, provided it is still
+	// oldEncoded. The disabled prefix and user fields are kept.
+	ReplaceEncoding(ctx context.Context, username, oldEncoded, newEncoded string) error
+}
+
+// FileStore is a Store reading an htpasswd file.
+type FileStore struct {
+	Path string
+	// Key decrypts the file, if not nil, see WithEncryptionKey.
+	Key []byte
+	// PublicKey verifies the signature of the file, if not nil, see WithPublicKey.
+	PublicKey ed25519.PublicKey
+}
+
+// Load implements Store.
+func (s *FileStore) Load(ctx context.Context) ([]Entry, string, error) {
+	content, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open htpasswd file %s: %w", s.Path, err)
+	}
+	return loadContent(content, s.Path, protection{s.Key, s.PublicKey}, func() ([]byte, error) {
+		return os.ReadFile(s.Path + SignatureSuffix)
+	})
+}
+
+// ReplaceEncoding implements ReplacingStore.
+func (s *FileStore) ReplaceEncoding(ctx context.Context, username, oldEncoded, newEncoded string) error {
+	return replaceInFile(s.Path, protection{s.Key, s.PublicKey}, username, oldEncoded, newEncoded)
+}
+
+// FSStore is a Store reading an htpasswd file from a file system, like an embed.FS.
+type FSStore struct {
+	FS   fs.FS
+	Path string
+	// Key decrypts the file, if not nil, see WithEncryptionKey.
+	Key []byte
+	// PublicKey verifies the signature of the file, if not nil, see WithPublicKey.
+	PublicKey ed25519.PublicKey
+}
+
+// Load implements Store.
+func (s *FSStore) Load(ctx context.Context) ([]Entry, string, error) {
+	content, err := fs.ReadFile(s.FS, s.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open htpasswd file %s: %w", s.Path, err)
+	}
+	return loadContent(content, s.Path, protection{s.Key, s.PublicKey}, func() ([]byte, error) {
+		return fs.ReadFile(s.FS, s.Path+SignatureSuffix)
+	})
+}
+
+// BytesStore is a Store with the content of an htpasswd file.
+type BytesStore []byte
+
+// Load implements Store.
+func (s BytesStore) Load(ctx context.Context) ([]Entry, string, error) {
+	return loadContent(s, "", protection{}, nil)
+}
+
+// MapStore is a Store with the users in a map from username to encoded password.
+type MapStore map[string]string
+
+// Load implements Store.
+func (s MapStore) Load(ctx context.Context) ([]Entry, string, error) {
+	entries := make([]Entry, 0, len(s))
+	for username, value := range s {
+		entries = append(entries, Entry{Username: username, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Username < entries[j].Username })
+
+	return entries, entriesVersion(entries), nil
+}
+
+// entriesVersion hashes the usernames and values of the entries.
+func entriesVersion(entries []Entry) string {
+	h := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%d:%s%d:%s", len(e.Username), e.Username, len(e.Value), e.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadContent verifies, decrypts and parses the content of an htpasswd file, its version is
+// the hash of it. readDetached reads the detached signature file, it may be nil.
+func loadContent(content []byte, name string, prot protection, readDetached func() ([]byte, error)) ([]Entry, string, error) {
+	opened, err := prot.open(content, name, readDetached)
+	if err != nil {
+		return nil, "", err
+	}
+	entries, err := parseEntries(bytes.NewReader(opened), name)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(content)
+	return entries, hex.EncodeToString(sum[:]), nil
+}
+
+// parseEntries splits the lines of an htpasswd file into entries, skipping empty lines and
+// comments. name is the name of the file, if any, used for the source of the entries.
+func parseEntries(r io.Reader, name string) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		// ignore empty line
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// ignore comment line. Inline comments are not allowed
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var source string
+		if name != "" {
+			source = fmt.Sprintf("%s:%d", name, lineNo)
+		}
+
+		// split "user:encoding" at colon
+		user, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, withSource(source, fmt.Errorf("malformed line, no colon: %s", line))
+		}
+		entries = append(entries, Entry{Username: user, Value: value, Source: source})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning htpasswd file failed: %w", err)
+	}
+
+	return entries, nil
+}
+
+// withSource prefixes the error message with the source, if any.
+func withSource(source string, err error) error {
+	if source == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", source, err)
+}
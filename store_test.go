@@ -0,0 +1,101 @@
+package htpasswd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore counts the loads of the wrapped store.
+type countingStore struct {
+	Store
+	loads int
+}
+
+func (s *countingStore) Load(ctx context.Context) ([]Entry, string, error) {
+	s.loads++
+	return s.Store.Load(ctx)
+}
+
+func TestStores(t *testing.T) {
+	contents := "# comment\n\nbob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\nalice:bar\n"
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, os.WriteFile(filename, []byte(contents), 0o640))
+
+	for name, store := range map[string]Store{
+		"file":  &FileStore{Path: filename},
+		"fs":    &FSStore{FS: fstest.MapFS{"htpasswd": {Data: []byte(contents)}}, Path: "htpasswd"},
+		"bytes": BytesStore(contents),
+		"map":   MapStore{"bob": "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "alice": "bar"},
+	} {
+		htp, err := NewFromStore(store)
+		assert.NoError(t, err, name)
+		assert.True(t, htp.Match("bob", "password"), name)
+		assert.True(t, htp.Match("alice", "bar"), name)
+		assert.False(t, htp.Match("alice", "password"), name)
+	}
+}
+
+func TestStoreEntries(t *testing.T) {
+	entries, version, err := BytesStore("# comment\nbob:x:y\n\nalice:bar\n").Load(context.Background())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, version)
+	assert.Equal(t, []Entry{{Username: "bob", Value: "x:y"}, {Username: "alice", Value: "bar"}}, entries)
+
+	entries, _, err = (&FSStore{FS: fstest.MapFS{"a": {Data: []byte("\nbob:bar\n")}}, Path: "a"}).Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{{Username: "bob", Value: "bar", Source: "a:2"}}, entries)
+
+	_, _, err = (&FSStore{FS: fstest.MapFS{"a": {Data: []byte("bob:bar\nalice\n")}}, Path: "a"}).Load(context.Background())
+	assert.EqualError(t, err, "a:2: malformed line, no colon: alice")
+
+	_, _, err = (&FSStore{FS: fstest.MapFS{}, Path: "a"}).Load(context.Background())
+	assert.Error(t, err)
+
+	// the version of a map doesn't depend on the iteration order
+	_, v1, _ := MapStore{"a": "1", "b": "2", "c": "3"}.Load(context.Background())
+	_, v2, _ := MapStore{"c": "3", "b": "2", "a": "1"}.Load(context.Background())
+	_, v3, _ := MapStore{"a": "1", "b": "2", "c": "4"}.Load(context.Background())
+	assert.Equal(t, v1, v2)
+	assert.NotEqual(t, v1, v3)
+}
+
+func TestStoreErrorSource(t *testing.T) {
+	fsys := fstest.MapFS{"htpasswd": {Data: []byte("bob:bar\nBob:bar\n")}}
+	_, err := NewFromStore(&FSStore{FS: fsys, Path: "htpasswd"}, WithUsernameNormalizers(CaseFold))
+	assert.ErrorContains(t, err, "htpasswd:2: conflicting users")
+}
+
+func TestReloadUnchangedVersion(t *testing.T) {
+	store := &countingStore{Store: MapStore{"bob": "bar"}}
+	htp, err := NewFromStore(store)
+	assert.NoError(t, err)
+	table := htp.passwds.Load()
+
+	assert.NoError(t, htp.Reload())
+	assert.Equal(t, 2, store.loads)
+	assert.Same(t, table, htp.passwds.Load())
+
+	store.Store = MapStore{"bob": "baz"}
+	assert.NoError(t, htp.Reload())
+	assert.NotSame(t, table, htp.passwds.Load())
+	assert.True(t, htp.Match("bob", "baz"))
+
+	// a reader has no version, so the next reload parses the store again
+	assert.NoError(t, htp.ReloadFromReader(strings.NewReader("bob:bar\n")))
+	assert.True(t, htp.Match("bob", "bar"))
+	assert.NoError(t, htp.Reload())
+	assert.True(t, htp.Match("bob", "baz"))
+}
+
+func TestReloadWithoutStore(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader("bob:bar\n"))
+	assert.NoError(t, err)
+	assert.Error(t, htp.Reload())
+	assert.True(t, htp.Match("bob", "bar"))
+}
@@ -0,0 +1,205 @@
+package htpasswd
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A ThrottleStore keeps track of failed login attempts by key. The keys are made up by
+// the middleware from the username and the client IP. Implement it to share the state
+// between several instances of a service, e.g. in redis.
+type ThrottleStore interface {
+	// Delay returns how long the next attempt for key has to wait, or 0 if it is allowed.
+	Delay(key string, now time.Time) time.Duration
+	// Fail records a failed attempt for key.
+	Fail(key string, now time.Time)
+	// Reset forgets the failed attempts for key.
+	Reset(key string)
+}
+
+// A MemoryThrottleStore is an in-memory ThrottleStore with exponential backoff: after the
+// free attempts, each failed attempt doubles the delay, starting at the base delay and up to
+// the max delay. The failures of a key are forgotten after no attempt failed for the max
+// delay.
+type MemoryThrottleStore struct {
+	freeAttempts int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]*failedAttempts
+	fails    int // failures since the last sweep
+}
+
+type failedAttempts struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+// sweepInterval is the number of failures after which forgotten keys are removed.
+const sweepInterval = 1024
+
+// NewMemoryThrottleStore creates a MemoryThrottleStore.
+func NewMemoryThrottleStore(freeAttempts int, baseDelay, maxDelay time.Duration) *MemoryThrottleStore {
+	return &MemoryThrottleStore{
+		freeAttempts: freeAttempts,
+		baseDelay:    baseDelay,
+		maxDelay:     maxDelay,
+		attempts:     make(map[string]*failedAttempts),
+	}
+}
+
+// Delay implements ThrottleStore.
+func (s *MemoryThrottleStore) Delay(key string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok || !now.Before(a.until) {
+		return 0
+	}
+	return a.until.Sub(now)
+}
+
+// Fail implements ThrottleStore.
+func (s *MemoryThrottleStore) Fail(key string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok || s.forgotten(a, now) {
+		a = &failedAttempts{}
+		s.attempts[key] = a
+	}
+	a.count++
+	a.last = now
+	if excess := a.count - s.freeAttempts; excess > 0 {
+		delay := s.baseDelay
+		for i := 1; i < excess && delay < s.maxDelay; i++ {
+			delay *= 2
+		}
+		a.until = now.Add(min(delay, s.maxDelay))
+	}
+
+	s.fails++
+	if s.fails >= sweepInterval {
+		s.fails = 0
+		for k, a := range s.attempts {
+			if s.forgotten(a, now) {
+				delete(s.attempts, k)
+			}
+		}
+	}
+}
+
+// Reset implements ThrottleStore.
+func (s *MemoryThrottleStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+}
+
+func (s *MemoryThrottleStore) forgotten(a *failedAttempts, now time.Time) bool {
+	return now.Sub(a.last) > s.maxDelay && !now.Before(a.until)
+}
+
+// A Throttle slows down password guessing in the BasicAuthMiddleware. Failed attempts are
+// counted per username, normalized by Htpasswd.Normalize, and per client IP; while either
+// of them is delayed, requests are answered with 429 Too Many Requests and a Retry-After
+// header, without checking the password.
+type Throttle struct {
+	store          ThrottleStore
+	trustedProxies []netip.Prefix
+	ipv6Bits       int // see SetIPv6PrefixLength
+	now            func() time.Time
+}
+
+// NewThrottle creates a Throttle keeping its state in store.
+//
+// The client IP is the remote address of the request. If that is one of trustedProxies,
+// the X-Forwarded-For header is searched from right to left for the first address which is
+// not a trusted proxy. IPv6 clients are counted per /64 network, see SetIPv6PrefixLength.
+func NewThrottle(store ThrottleStore, trustedProxies ...netip.Prefix) *Throttle {
+	return &Throttle{store: store, trustedProxies: trustedProxies, ipv6Bits: 64, now: time.Now}
+}
+
+// SetIPv6PrefixLength sets the length of the network prefix by which IPv6 clients are
+// counted, 64 by default, as a client usually controls a whole /64 network and could
+// otherwise evade the throttle by changing its address. 128 counts every address.
+func (t *Throttle) SetIPv6PrefixLength(bits int) {
+	t.ipv6Bits = min(max(bits, 0), 128)
+}
+
+// delay returns how long the request has to wait.
+func (t *Throttle) delay(user, ip string) time.Duration {
+	now := t.now()
+	return max(t.store.Delay("user:"+user, now), t.store.Delay("ip:"+ip, now))
+}
+
+func (t *Throttle) fail(user, ip string) {
+	now := t.now()
+	t.store.Fail("user:"+user, now)
+	t.store.Fail("ip:"+ip, now)
+}
+
+func (t *Throttle) succeed(user string) {
+	// The failures of the client IP are kept. Otherwise a valid account would allow to
+	// guess the passwords of other accounts without delay.
+	t.store.Reset("user:" + user)
+}
+
+// clientIP returns the IP of the client of the request, or its network for IPv6.
+func (t *Throttle) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if !t.trusted(addr) {
+		return t.clientKey(addr)
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !t.trusted(addr) {
+			break
+		}
+	}
+	return t.clientKey(addr)
+}
+
+// clientKey returns the address, or its network for IPv6.
+func (t *Throttle) clientKey(addr netip.Addr) string {
+	if !addr.Is6() || t.ipv6Bits == 128 {
+		return addr.String()
+	}
+	prefix, err := addr.WithZone("").Prefix(t.ipv6Bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+func (t *Throttle) trusted(addr netip.Addr) bool {
+	for _, prefix := range t.trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package htpasswd
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryThrottleStore(t *testing.T) {
+	store := NewMemoryThrottleStore(2, time.Second, 5*time.Second)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store.Fail("k", now)
+	store.Fail("k", now)
+	assert.Zero(t, store.Delay("k", now))
+
+	store.Fail("k", now)
+	assert.Equal(t, time.Second, store.Delay("k", now))
+	store.Fail("k", now)
+	assert.Equal(t, 2*time.Second, store.Delay("k", now))
+	store.Fail("k", now)
+	assert.Equal(t, 4*time.Second, store.Delay("k", now))
+	store.Fail("k", now)
+	assert.Equal(t, 5*time.Second, store.Delay("k", now))
+	assert.Equal(t, 3*time.Second, store.Delay("k", now.Add(2*time.Second)))
+	assert.Zero(t, store.Delay("k", now.Add(5*time.Second)))
+	assert.Zero(t, store.Delay("other", now))
+
+	// after a quiet period the failures are forgotten
+	now = now.Add(11 * time.Second)
+	store.Fail("k", now)
+	assert.Zero(t, store.Delay("k", now))
+
+	store.Fail("k", now)
+	store.Fail("k", now)
+	assert.NotZero(t, store.Delay("k", now))
+	store.Reset("k")
+	assert.Zero(t, store.Delay("k", now))
+}
+
+func TestThrottleClientIP(t *testing.T) {
+	throttle := NewThrottle(nil, netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128"))
+
+	for _, tc := range []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+		{"10.1.2.3:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"10.1.2.3:1234", []string{"203.0.113.9, 198.51.100.7, 10.4.4.4"}, "198.51.100.7"},
+		{"10.1.2.3:1234", []string{"203.0.113.9", "198.51.100.7"}, "198.51.100.7"},
+		{"10.1.2.3:1234", []string{"10.9.9.9, 10.8.8.8"}, "10.9.9.9"},
+		{"10.1.2.3:1234", []string{"garbage, 10.8.8.8"}, "10.8.8.8"},
+		{"[::1]:1234", []string{"2001:db8::1"}, "2001:db8::/64"},
+		{"[2001:db8:1:2:3:4:5:6]:1234", nil, "2001:db8:1:2::/64"},
+		{"[::ffff:192.0.2.1]:1234", nil, "192.0.2.1"},
+		{"[::ffff:10.1.2.3]:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, f := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		assert.Equal(t, tc.expected, throttle.clientIP(r), tc)
+	}
+}
+
+func TestThrottleIPv6PrefixLength(t *testing.T) {
+	throttle := NewThrottle(nil)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:1234"
+
+	throttle.SetIPv6PrefixLength(48)
+	assert.Equal(t, "2001:db8:1::/48", throttle.clientIP(r))
+	throttle.SetIPv6PrefixLength(128)
+	assert.Equal(t, "2001:db8:1:2:3:4:5:6", throttle.clientIP(r))
+}
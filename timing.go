@@ -0,0 +1,122 @@
+package htpasswd
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// WithConstantTimeUnknownUsers makes Match take as long for unknown users as for the
+// strongest encoded password in the htpasswd file. Without it Match returns immediately
+// for unknown users, while a bcrypt comparison takes a noticeable time, so an attacker
+// could tell valid usernames apart by timing.
+//
+// When the file is loaded, a dummy password with the algorithm and parameters (bcrypt
+// cost, crypt-sha rounds) of the strongest entry is made up, and the password given for an
+// unknown user is checked against it. The outcome of that check is ignored. If all users
+// have passwords of custom parsers, the password of one of them is checked instead; if
+// there are custom and builtin algorithms, pass WithDummyPassword with the slowest one.
+//
+// The users of a LookupStore, like an SQLStore without LoadQuery, are not loaded, so there
+// is nothing to make up the dummy password from. Pass WithDummyPassword in that case,
+// otherwise creating the Htpasswd fails.
+func WithConstantTimeUnknownUsers() Option {
+	return func(p *parameters) {
+		p.constantTime = true
+	}
+}
+
+// WithDummyPassword sets the encoded password checked for unknown users with
+// WithConstantTimeUnknownUsers, instead of making it up from the loaded users. Encode any
+// password with the algorithm and parameters of the strongest users of the store, e.g.
+//
+//	encoded, _ := htpasswd.BcryptEncoder(12)("dummy")
+//	htpasswd.NewFromStore(store, htpasswd.WithConstantTimeUnknownUsers(), htpasswd.WithDummyPassword(encoded))
+func WithDummyPassword(encoded string) Option {
+	return func(p *parameters) {
+		p.dummy = encoded
+	}
+}
+
+// strengthTier ranks the algorithms by the effort to check a password.
+var strengthTier = map[Algorithm]int{
+	AlgorithmPlain:       1,
+	AlgorithmSha:         2,
+	AlgorithmSsha:        2,
+	AlgorithmMd5Crypt:    3,
+	AlgorithmApr1:        3,
+	AlgorithmCryptSha256: 4,
+	AlgorithmCryptSha512: 5,
+	AlgorithmBcrypt:      6,
+}
+
+// strength returns the rank of the algorithm and the work factor within the algorithm.
+func strength(ep EncodedPasswd) (int, int) {
+	switch p := ep.(type) {
+	case *bcryptPassword:
+		cost, err := bcrypt.Cost(p.hashed)
+		if err != nil {
+			return 0, 0
+		}
+		return strengthTier[AlgorithmBcrypt], cost
+	case *cryptPassword:
+		return strengthTier[p.algorithm()], p.roundCount()
+	}
+	return strengthTier[algorithmOf(ep)], 0
+}
+
+// makeDummy returns the password checked for unknown users when table is loaded.
+func (bf *Htpasswd) makeDummy(table passwdTable) (EncodedPasswd, error) {
+	if bf.dummyEncoded != "" {
+		dummy, err := bf.parse("the dummy password", bf.dummyEncoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dummy password: %w", err)
+		}
+		return dummy, nil
+	}
+
+	dummy := dummyPasswd(table)
+	if _, ok := bf.store.(LookupStore); ok && dummy == nil {
+		return nil, errors.New("constant time for unknown users of a LookupStore needs WithDummyPassword")
+	}
+	return dummy, nil
+}
+
+// dummyPasswd makes up an encoded password which takes as long to check as the strongest
+// encoded password in the table. If there are only passwords of custom parsers, whose
+// effort is unknown, the encoded password of one of their users is used as is. It returns
+// nil if there are no passwords at all.
+func dummyPasswd(table passwdTable) EncodedPasswd {
+	var strongest, custom EncodedPasswd
+	bestTier, bestWork := 0, 0
+	for _, entry := range table {
+		if entry.matcher == nil {
+			continue
+		}
+		tier, work := strength(entry.matcher)
+		if tier == 0 && custom == nil {
+			custom = entry.matcher
+		}
+		if tier > bestTier || (tier == bestTier && work > bestWork) {
+			strongest, bestTier, bestWork = entry.matcher, tier, work
+		}
+	}
+
+	switch p := strongest.(type) {
+	case *bcryptPassword:
+		hashed := fmt.Sprintf("%s%02d$%s", p.hashed[:4], bestWork, randomSalt(53))
+		return &bcryptPassword{hashed: []byte(hashed)}
+	case *cryptPassword:
+		return &cryptPassword{p.prefix, p.rounds, randomSalt(16), randomSalt(len(p.hashed))}
+	case *md5Password:
+		return &md5Password{randomSalt(len(p.salt)), randomSalt(22), p.prefix}
+	case *sshaPassword:
+		return &sshaPassword{[]byte(randomSalt(len(p.hashed))), []byte(randomSalt(len(p.salt)))}
+	case *shaPassword:
+		return &shaPassword{[]byte(randomSalt(len(p.hashed)))}
+	case *plainPassword:
+		return &plainPassword{randomSalt(16)}
+	}
+	return custom
+}
@@ -0,0 +1,78 @@
+package htpasswd
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var mixedContents = `plain:bar
+sha:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=
+apr1:$apr1$VfoHyKyF$EQ3gDdg7EUQB69/ppHOOU0
+bcrypt5:$2y$05$bWBMg3oUStnhfy5rFvoyreviPySU6hvEmBub5wIlM/D.c5FeYJQ6O
+bcrypt8:$2b$08$hQbZuw.cHsECArUAP9mOjehaJxTG9NMJfioQIHcbC0YyXpVybhoQa
+sha512:$6$rounds=6000$98765432101234567890$FPU3HtJ9RcPVUvxifkIJ/AlrBxWLqJQvyxK2f8x4qDX/A1RpcIvgjToU5erVkR6XUl7qwPsm7idpbMH5f/pBn0
+`
+
+func TestConstantTimeUnknownUsers(t *testing.T) {
+	htp, err := NewFromReader(strings.NewReader(mixedContents), WithConstantTimeUnknownUsers())
+	assert.NoError(t, err)
+
+	dummy := htp.dummy.Load()
+	assert.NotNil(t, dummy)
+	b, ok := (*dummy).(*bcryptPassword)
+	assert.True(t, ok)
+	cost, err := bcrypt.Cost(b.hashed)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, cost)
+
+	assert.True(t, htp.Match("bcrypt8", "bar"))
+	assert.False(t, htp.Match("unknown", "bar"))
+	assert.False(t, htp.Match("unknown", ""))
+}
+
+func TestDummyPasswd(t *testing.T) {
+	for contents, algorithm := range map[string]Algorithm{
+		"a:bar\nb:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n":      AlgorithmSha,
+		"a:{SSHA}/lLSOXpMWipWr3ifiighLCpqBiFoMzBM\nb:bar\n": AlgorithmSsha,
+		"a:bar\nb:$apr1$VfoHyKyF$EQ3gDdg7EUQB69/ppHOOU0\n":  AlgorithmApr1,
+		textPlain:       AlgorithmPlain,
+		testCryptSha256: AlgorithmCryptSha256,
+		testCryptSha512: AlgorithmCryptSha512,
+	} {
+		htp, err := NewFromReader(strings.NewReader(contents), WithConstantTimeUnknownUsers())
+		assert.NoError(t, err)
+		dummy := htp.dummy.Load()
+		assert.Equal(t, algorithm, algorithmOf(*dummy))
+		assert.False(t, (*dummy).MatchesPassword("bar"))
+	}
+
+	// the rounds of crypt-sha are kept
+	table := passwdTable{}
+	ep, _ := CryptSha("$6$rounds=6000$98765432101234567890$FPU3HtJ9RcPVUvxifkIJ/AlrBxWLqJQvyxK2f8x4qDX/A1RpcIvgjToU5erVkR6XUl7qwPsm7idpbMH5f/pBn0")
+	table["a"] = &passwdEntry{matcher: ep}
+	dummy := dummyPasswd(table).(*cryptPassword)
+	assert.Equal(t, 6000, dummy.roundCount())
+
+	// no passwords, no dummy
+	assert.Nil(t, dummyPasswd(passwdTable{}))
+	assert.Nil(t, dummyPasswd(passwdTable{"a": &passwdEntry{}}))
+
+	htp, err := NewFromReader(strings.NewReader(mixedContents))
+	assert.NoError(t, err)
+	assert.Nil(t, htp.dummy.Load())
+}
+
+func TestConstantTimeCustomParser(t *testing.T) {
+	var checks atomic.Int32
+	htp, err := NewFromReader(strings.NewReader("alice:bar\n"),
+		WithParsers(countingParser(&checks)), WithConstantTimeUnknownUsers())
+	assert.NoError(t, err)
+
+	// the password of alice is checked for unknown users
+	assert.False(t, htp.Match("nobody", "bar"))
+	assert.Equal(t, int32(1), checks.Load())
+}
@@ -0,0 +1,180 @@
+package htpasswd
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A UserField describes the meaning of an extra colon separated field following the encoded
+// password, as in "user:passwd-encoding:field1:field2".
+type UserField int
+
+const (
+	// FieldIgnore skips the field. It is only available through User.Fields.
+	FieldIgnore UserField = iota
+	// FieldComment is a free text comment, as supported by nginx.
+	FieldComment
+	// FieldDisplayName is the full name of the user.
+	FieldDisplayName
+	// FieldEmail is the email address of the user.
+	FieldEmail
+	// FieldExpires is the time the account expires. It is either a date like 2006-01-02,
+	// meaning the start of that day in UTC, or seconds since the Unix epoch. An empty field
+	// never expires.
+	FieldExpires
+	// FieldFlags is a comma separated list of flags.
+	FieldFlags
+)
+
+var userFieldNames = []string{"ignore", "comment", "display name", "email", "expires", "flags"}
+
+func (f UserField) String() string {
+	if f < 0 || int(f) >= len(userFieldNames) {
+		return fmt.Sprintf("UserField(%d)", int(f))
+	}
+	return userFieldNames[f]
+}
+
+// A User is the record of a user in the password file, without the encoded password.
+type User struct {
+	// Name is the username as written in the password file.
+	Name        string
+	Comment     string
+	DisplayName string
+	Email       string
+	// Expires is the zero time if the account does not expire.
+	Expires time.Time
+	// Disabled is set if the encoded password has the disabled prefix.
+	Disabled bool
+	Flags    []string
+	// Fields are all extra fields following the encoded password, including those which
+	// are not mapped by the field layout.
+	Fields []string
+}
+
+// HasFlag reports whether the user has the flag.
+func (u User) HasFlag(flag string) bool {
+	return slices.Contains(u.Flags, flag)
+}
+
+// Expired reports whether the account is expired at the time now.
+func (u User) Expired(now time.Time) bool {
+	return !u.Expires.IsZero() && !now.Before(u.Expires)
+}
+
+// clone returns a copy of u that does not share memory with u.
+func (u User) clone() User {
+	u.Flags = slices.Clone(u.Flags)
+	u.Fields = slices.Clone(u.Fields)
+	return u
+}
+
+// parseUserFields fills the user record from the extra fields according to the layout.
+func parseUserFields(user *User, layout []UserField, fields []string) error {
+	user.Fields = fields
+	for i, field := range fields {
+		if i >= len(layout) {
+			break
+		}
+
+		switch layout[i] {
+		case FieldComment:
+			user.Comment = field
+		case FieldDisplayName:
+			user.DisplayName = field
+		case FieldEmail:
+			user.Email = field
+		case FieldExpires:
+			expires, err := parseExpires(field)
+			if err != nil {
+				return fmt.Errorf("malformed expiry for %s: %w", user.Name, err)
+			}
+			user.Expires = expires
+		case FieldFlags:
+			for _, flag := range strings.Split(field, ",") {
+				if flag = strings.TrimSpace(flag); flag != "" {
+					user.Flags = append(user.Flags, flag)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func parseExpires(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("neither a date nor a unix time: %s", s)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// formatUserFields is the counterpart of parseUserFields. It fails if the user has data
+// which can't be written in the layout.
+func formatUserFields(user User, layout []UserField) ([]string, error) {
+	fields := make([]string, len(layout))
+	written := make(map[UserField]bool)
+	for i, field := range layout {
+		switch field {
+		case FieldComment:
+			fields[i] = user.Comment
+		case FieldDisplayName:
+			fields[i] = user.DisplayName
+		case FieldEmail:
+			fields[i] = user.Email
+		case FieldExpires:
+			fields[i] = formatExpires(user.Expires)
+		case FieldFlags:
+			for _, flag := range user.Flags {
+				if strings.Contains(flag, ",") {
+					return nil, fmt.Errorf("flag %q of %s contains a comma", flag, user.Name)
+				}
+			}
+			fields[i] = strings.Join(user.Flags, ",")
+		}
+		if strings.ContainsAny(fields[i], ":\r\n") {
+			return nil, fmt.Errorf("field %q of %s contains a colon or line break", fields[i], user.Name)
+		}
+		written[field] = true
+	}
+
+	for _, f := range []struct {
+		field UserField
+		set   bool
+	}{
+		{FieldComment, user.Comment != ""},
+		{FieldDisplayName, user.DisplayName != ""},
+		{FieldEmail, user.Email != ""},
+		{FieldExpires, !user.Expires.IsZero()},
+		{FieldFlags, len(user.Flags) > 0},
+	} {
+		if f.set && !written[f.field] {
+			return nil, fmt.Errorf("%s of %s can't be written: no such field in the layout", f.field, user.Name)
+		}
+	}
+
+	// trailing empty fields are left out
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return fields, nil
+}
+
+func formatExpires(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	if t.Equal(t.UTC().Truncate(24 * time.Hour)) {
+		return t.UTC().Format(time.DateOnly)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
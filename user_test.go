@@ -0,0 +1,75 @@
+package htpasswd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var userFieldsContents = `alice:$apr1$VfoHyKyF$EQ3gDdg7EUQB69/ppHOOU0:Alice Liddell:alice@example.com:2030-01-02:admin, ops
+bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=:Bob
+carol:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+dave:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=:::1893456000::extra
+`
+
+func TestUserFields(t *testing.T) {
+	layout := []UserField{FieldDisplayName, FieldEmail, FieldExpires, FieldFlags}
+	htp, err := NewFromReader(strings.NewReader(userFieldsContents), WithUserFields(layout...))
+	assert.NoError(t, err)
+
+	assert.True(t, htp.Match("alice", "password"))
+	assert.True(t, htp.Match("bob", "password"))
+	assert.True(t, htp.Match("carol", "password"))
+	assert.True(t, htp.Match("dave", "password"))
+
+	alice, ok := htp.User("alice")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", alice.Name)
+	assert.Equal(t, "Alice Liddell", alice.DisplayName)
+	assert.Equal(t, "alice@example.com", alice.Email)
+	assert.Equal(t, time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC), alice.Expires)
+	assert.Equal(t, []string{"admin", "ops"}, alice.Flags)
+	assert.True(t, alice.HasFlag("ops"))
+	assert.False(t, alice.HasFlag("root"))
+
+	bob, ok := htp.User("bob")
+	assert.True(t, ok)
+	assert.Equal(t, "Bob", bob.DisplayName)
+	assert.True(t, bob.Expires.IsZero())
+	assert.Equal(t, []string{"Bob"}, bob.Fields)
+
+	dave, ok := htp.User("dave")
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1893456000, 0).UTC(), dave.Expires)
+	assert.Equal(t, []string{"", "", "1893456000", "", "extra"}, dave.Fields)
+
+	_, ok = htp.User("nobody")
+	assert.False(t, ok)
+
+	// the returned record is a copy
+	alice.Flags[0] = "changed"
+	alice, _ = htp.User("alice")
+	assert.Equal(t, "admin", alice.Flags[0])
+}
+
+func TestUserFieldsDisabled(t *testing.T) {
+	// without the option the extra fields are part of the password
+	htp, err := NewFromReader(strings.NewReader("alice:secret:comment\n"))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "secret:comment"))
+
+	alice, ok := htp.User("alice")
+	assert.True(t, ok)
+	assert.Empty(t, alice.Fields)
+
+	htp, err = NewFromReader(strings.NewReader("alice:secret:comment\n"), WithUserFields(FieldComment))
+	assert.NoError(t, err)
+	assert.True(t, htp.Match("alice", "secret"))
+	alice, _ = htp.User("alice")
+	assert.Equal(t, "comment", alice.Comment)
+
+	_, err = NewFromReader(strings.NewReader("alice:secret:tomorrow\n"), WithUserFields(FieldExpires))
+	assert.Error(t, err)
+}
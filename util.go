@@ -1,6 +1,7 @@
 package htpasswd
 
 import (
+	"crypto/rand"
 	"crypto/sha1"
 	"crypto/subtle"
 )
@@ -16,3 +17,16 @@ func constantTimeEquals(a string, b string) bool {
 	}
 	return false
 }
+
+// saltAlphabet is the alphabet of the salt in crypt(3) style hashes.
+const saltAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// randomSalt returns n random characters of saltAlphabet.
+func randomSalt(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = saltAlphabet[int(b[i])%len(saltAlphabet)]
+	}
+	return string(b)
+}